@@ -0,0 +1,163 @@
+package ast_test
+
+import (
+	"bytes"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/errstmt"
+	"github.com/jba/errside/parser"
+)
+
+const sideNoteSrc = `package p
+
+func f() (int, error) {
+	// lead
+	n := g() =: err; if err != nil {
+		// handler
+		return 0, err
+	} // line
+	return n, nil
+}
+`
+
+// parseSideNote parses sideNoteSrc and returns it with its side note.
+func parseSideNote(t *testing.T) (*token.FileSet, *ast.File, *errstmt.AssignIfErrStmt) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", sideNoteSrc, parser.ParseComments|parser.SideNotes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := file.Decls[0].(*ast.FuncDecl).Body.List[0].(*errstmt.AssignIfErrStmt)
+	if !ok {
+		t.Fatalf("got %T, want a side note", file.Decls[0].(*ast.FuncDecl).Body.List[0])
+	}
+	return fset, file, s
+}
+
+// Walk visits the children of a side note, and everything below them.
+func TestWalkSideNote(t *testing.T) {
+	_, file, s := parseSideNote(t)
+	visited := make(map[ast.Node]bool)
+	depth := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+		} else {
+			visited[n] = true
+			depth++
+		}
+		return true
+	})
+	if depth != 0 {
+		t.Errorf("Inspect left %d nodes unfinished", depth)
+	}
+	ret := s.IfStmt.Body.List[0].(*ast.ReturnStmt)
+	for _, n := range []ast.Node{
+		s,
+		s.FirstStmt,
+		s.FirstStmt.(*ast.AssignStmt).Lhs[0],
+		s.FirstStmt.(*ast.AssignStmt).Rhs[0],
+		s.ErrVar,
+		s.IfStmt,
+		s.IfStmt.Cond,
+		s.IfStmt.Body,
+		ret,
+		ret.Results[1],
+	} {
+		if !visited[n] {
+			t.Errorf("%T at %d was not visited", n, n.Pos())
+		}
+	}
+}
+
+// Comments are associated with a side note and with the statements in it.
+func TestCommentMapSideNote(t *testing.T) {
+	fset, file, s := parseSideNote(t)
+	cmap := ast.NewCommentMap(fset, file, file.Comments)
+	texts := func(n ast.Node) string {
+		var list []string
+		for _, g := range cmap[n] {
+			list = append(list, strings.TrimSpace(g.Text()))
+		}
+		return strings.Join(list, ",")
+	}
+	if got, want := texts(s), "lead,line"; got != want {
+		t.Errorf("comments of the side note: got %q, want %q", got, want)
+	}
+	if got, want := texts(s.IfStmt.Body.List[0]), "handler"; got != want {
+		t.Errorf("comments of the return statement: got %q, want %q", got, want)
+	}
+
+	// Filtering keeps the side note, and printing the AST does not fail.
+	if !ast.FilterFile(file, func(string) bool { return true }) {
+		t.Error("FilterFile removed everything")
+	}
+	var buf bytes.Buffer
+	if err := ast.Fprint(&buf, fset, file, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "*errstmt.AssignIfErrStmt") {
+		t.Errorf("Fprint output does not contain the side note:\n%s", buf.String())
+	}
+}
+
+// reversed is an external statement whose children are not in source
+// order.
+type reversed struct {
+	list []ast.Stmt
+}
+
+func (r *reversed) Pos() token.Pos { return r.list[0].Pos() }
+func (r *reversed) End() token.Pos { return r.list[len(r.list)-1].End() }
+func (*reversed) StmtNode()        {}
+
+func (r *reversed) Children() []ast.Node {
+	var list []ast.Node
+	for i := len(r.list) - 1; i >= 0; i-- {
+		list = append(list, r.list[i])
+	}
+	return list
+}
+
+// Comments are associated with the children of an external node in source
+// order, whatever the order of Children.
+func TestCommentMapExternalOrder(t *testing.T) {
+	const src = `package p
+
+func f() {
+	// a
+	a()
+	// b
+	b()
+	// c
+	c()
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := file.Decls[0].(*ast.FuncDecl).Body
+	stmts := body.List
+	r := &reversed{stmts}
+	body.List = []ast.Stmt{r}
+	cmap := ast.NewCommentMap(fset, file, file.Comments)
+	for _, test := range []struct {
+		node ast.Node
+		want string
+	}{
+		{r, "a"}, // the comment precedes r as well as a()
+		{stmts[1], "b"},
+		{stmts[2], "c"},
+	} {
+		g := cmap[test.node]
+		if len(g) != 1 || strings.TrimSpace(g[0].Text()) != test.want {
+			t.Errorf("comments of %T at %d: got %d groups, want %q", test.node, test.node.Pos(), len(g), test.want)
+		}
+	}
+}
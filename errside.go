@@ -1,248 +1,430 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"go/build"
+	"go/scanner"
 	"go/token"
-
+	"html"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/jba/errside/ast"
-	"github.com/jba/errside/errstmt"
-	"github.com/jba/errside/importer"
+	"github.com/jba/errside/internal/srcimporter"
 	"github.com/jba/errside/parser"
-	"github.com/jba/errside/printer"
+	"github.com/jba/errside/sidenote"
 	"github.com/jba/errside/types"
 )
 
-var errcol = flag.Int("e", 50, "error column")
+var (
+	errcol  = flag.Int("e", 50, "error column")
+	width   = flag.Int("width", 100, "maximum width of a line holding a one-line side note; 0 for no limit")
+	write   = flag.Bool("w", false, "write result to a file next to each source file instead of stdout")
+	outdir  = flag.String("o", "", "write results to a mirror of the source tree rooted at `dir`; the sources must be within the current directory")
+	list    = flag.Bool("l", false, "list files in which side notes would be introduced")
+	ext     = flag.String("ext", ".goe", "extension of written files, replacing .go")
+	tags    = flag.String("tags", "", "comma-separated list of build tags to satisfy")
+	anyerr  = flag.Bool("anyerror", false, "fold checks on values of any type implementing error, not just of type error")
+	auto    = flag.Bool("auto", false, "choose the error column of each function, between -mine and -maxe, instead of using -e")
+	mine    = flag.Int("mine", 40, "smallest error column with -auto")
+	maxe    = flag.Int("maxe", 0, "largest error column with -auto; 0 for 20 columns before -width")
+	htmlOut = flag.Bool("html", false, "print HTML with the side notes in a column of their own; the default -ext becomes .html")
+	term    = flag.Bool("term", false, "print for a terminal, with side notes in -notecolor; unless set, -width is the terminal width and -e half of it")
+	color   = flag.String("notecolor", "2", "SGR parameters of the color of side notes with -term")
+	glyphs  = flag.Bool("glyphs", false, "print common error handlers in a compact form that cannot be parsed back")
+	verify  = flag.Bool("verify", false, "check that the side notes read back as the original code, and report those that hide a difference")
+)
+
+var (
+	cfg  sidenote.Config
+	ctxt = build.Default       // build context, honoring -tags
+	imp  *srcimporter.Importer // shared so that imported packages are checked once
+)
 
 func main() {
 	flag.Parse()
+	if *write && *outdir != "" {
+		fmt.Fprintln(os.Stderr, "errside: -w and -o are mutually exclusive")
+		os.Exit(2)
+	}
+	if *htmlOut && !isSet("ext") {
+		*ext = ".html"
+	}
+	if *term {
+		if !isSet("width") {
+			if w := terminalWidth(); w > 0 {
+				*width = w
+			}
+		}
+		if !isSet("e") && *width > 0 {
+			*errcol = *width / 2
+		}
+	}
+	cfg = sidenote.Config{
+		Errcol:    *errcol,
+		Tabwidth:  4,
+		Width:     *width,
+		AnyError:  *anyerr,
+		Glyphs:    *glyphs,
+		Terminal:  *term,
+		NoteColor: *color,
+
+		AutoErrcol: *auto,
+		MinErrcol:  *mine,
+		MaxErrcol:  *maxe,
+	}
+	if *width == 0 {
+		cfg.Width = -1
+	}
+	ctxt.BuildTags = strings.FieldsFunc(*tags, func(r rune) bool { return r == ',' || r == ' ' })
+	imp = srcimporter.New(&ctxt, token.NewFileSet(), make(map[string]*types.Package))
+	// With -html, the files printed to stdout make up one document.
+	htmlDoc := *htmlOut && !*write && *outdir == "" && !*list
+	if htmlDoc {
+		fmt.Print(sidenote.HTMLHeader(strings.Join(flag.Args(), " ")))
+	}
 	ok := true
-	for _, dir := range flag.Args() {
-		if err := processDir(dir); err != nil {
-			fmt.Printf("%s: %v\n", dir, err)
+	for _, arg := range flag.Args() {
+		dirs, err := expand(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
 			ok = false
+			continue
 		}
+		for _, dir := range dirs {
+			err := processDir(dir)
+			if _, noGo := err.(*build.NoGoError); noGo && len(dirs) > 1 {
+				// Directories matched by a pattern need not contain a package.
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+				ok = false
+			}
+		}
+	}
+	if htmlDoc {
+		fmt.Print(sidenote.HTMLFooter)
 	}
 	if !ok {
 		os.Exit(1)
 	}
 }
 
-func processDir(dir string) error {
-	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
-	if err != nil {
-		return err
-	}
-	for _, pkg := range pkgs {
-		var files []*ast.File
-		for _, file := range pkg.Files {
-			files = append(files, file)
-		}
-		info := &types.Info{
-			Defs:  make(map[*ast.Ident]types.Object),
-			Uses:  make(map[*ast.Ident]types.Object),
-			Types: make(map[ast.Expr]types.TypeAndValue),
+// isSet reports whether the flag with the given name was set on the
+// command line.
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// terminalWidth returns the width of the terminal that errside writes to,
+// or 0 if it is unknown. Standard output is often a pager, so standard
+// error and $COLUMNS are consulted too.
+func terminalWidth() int {
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		if w := fileWidth(f); w > 0 {
+			return w
 		}
-		conf := types.Config{Importer: importer.Default()}
-		_, err := conf.Check("floop", fset, files, info)
+	}
+	w, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return w
+}
+
+// expand returns the directories denoted by a command-line argument.
+// An argument of the form "dir/..." denotes dir and all directories
+// below it, except those the go command ignores: directories named
+// testdata or vendor, those beginning with "." or "_", and those of
+// other modules, which hold a go.mod file of their own.
+func expand(arg string) ([]string, error) {
+	if arg != "..." && !strings.HasSuffix(arg, "/...") {
+		return []string{arg}, nil
+	}
+	root := strings.TrimSuffix(strings.TrimSuffix(arg, "..."), "/")
+	if root == "" {
+		root = "."
+	}
+	var dirs []string
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		for filename, file := range pkg.Files {
-			err := processFile(filename, file, fset, info)
-			if err != nil {
-				return err
-			}
-			conf := &printer.Config{
-				Mode:     printer.UseSpaces,
-				Tabwidth: 4,
-				Errcol:   *errcol,
+		if !fi.IsDir() {
+			return nil
+		}
+		if path != root {
+			name := fi.Name()
+			if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
 			}
-			if err := conf.Fprint(os.Stdout, fset, file); err != nil {
-				return err
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
 			}
 		}
-	}
-	return nil
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs, err
 }
 
-func processFile(filename string, file *ast.File, fset *token.FileSet, info *types.Info) error {
-	fmt.Printf("== file %s ==\n", filename)
-
-	ast.Inspect(file, func(n ast.Node) bool {
-		switch n := n.(type) {
-		case *ast.BlockStmt:
-			if n != nil {
-				processBlockStmt(n, fset, info)
-			}
-			return false
-
-		default:
-			return true
+// processDir rewrites the package in dir, as selected by the build context.
+// The package is type-checked together with its internal test files;
+// its external test package, if any, is checked separately.
+func processDir(dir string) error {
+	bp, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return err
+	}
+	path := importPath(bp)
+	fset := token.NewFileSet()
+	nerrs := 0
+	var filenames []string
+	filenames = append(filenames, bp.GoFiles...)
+	filenames = append(filenames, bp.CgoFiles...)
+	filenames = append(filenames, bp.TestGoFiles...)
+	pkg, err := processPackage(fset, path, dir, filenames, imp, &nerrs)
+	if err != nil {
+		return err
+	}
+	if len(bp.XTestGoFiles) > 0 {
+		ximp := imp.WithPackage(path, pkg)
+		if _, err := processPackage(fset, path+"_test", dir, bp.XTestGoFiles, ximp, &nerrs); err != nil {
+			return err
 		}
-	})
+	}
+	if nerrs > 0 {
+		return fmt.Errorf("%d errors", nerrs)
+	}
 	return nil
 }
 
-func processBlockStmt(bs *ast.BlockStmt, fset *token.FileSet, info *types.Info) {
-	var newList []ast.Stmt
-	for i, stmt := range bs.List {
-		newList = append(newList, stmt)
-		ifStmt, ok := stmt.(*ast.IfStmt)
-		if !ok {
-			continue
-		}
-		// We have an if statement.
-		// Does the if's test compare an identifier to nil?
-		obj, tb := onError(ifStmt.Cond, info)
-		if tb != True {
+// processPackage parses and type-checks the named files in dir as the package
+// with the given import path, and rewrites each file. Syntax and type errors
+// are reported and counted in *nerrs; a file with a syntax error is left out,
+// and the others are rewritten as far as they could be checked.
+func processPackage(fset *token.FileSet, path, dir string, names []string, imp types.Importer, nerrs *int) (*types.Package, error) {
+	sort.Strings(names)
+	var (
+		filenames []string
+		files     []*ast.File
+	)
+	for _, name := range names {
+		filename := filepath.Join(dir, name)
+		file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+		if err != nil {
+			scanner.PrintError(os.Stderr, err)
+			if list, ok := err.(scanner.ErrorList); ok {
+				*nerrs += len(list)
+			} else {
+				*nerrs++
+			}
 			continue
 		}
-		// Yes it does.
-		// Was the previous statement (or the statement inside the if) an assignment?
-		prevStmt := ifStmt.Init
-		if prevStmt == nil && i > 0 {
-			prevStmt = bs.List[i-1]
+		filenames = append(filenames, filename)
+		files = append(files, file)
+	}
+	info := &types.Info{
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Scopes:     make(map[ast.Node]*types.Scope),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{
+		Importer: imp,
+		// Report type errors, but transform whatever could be checked.
+		Error: func(err error) {
+			fmt.Fprintln(os.Stderr, err)
+			*nerrs++
+		},
+	}
+	before := *nerrs
+	pkg, _ := conf.Check(path, fset, files, info)
+	checked := *nerrs == before
+	for i, file := range files {
+		var check func(*token.FileSet, *ast.File) error
+		if checked {
+			check = func(xfset *token.FileSet, xfile *ast.File) error {
+				return checkExpanded(xfset, xfile, path, filenames, i, imp)
+			}
 		}
-		if prevStmt == nil {
-			continue
+		if err := processFile(filenames[i], file, fset, info, check, nerrs); err != nil {
+			return nil, err
 		}
-		aStmt, ok := prevStmt.(*ast.AssignStmt)
-		if !ok {
+	}
+	return pkg, nil
+}
+
+// checkExpanded type-checks xfile, the expansion of the ith of the named
+// files, together with the other files of the package, which are read
+// again from disk.
+func checkExpanded(xfset *token.FileSet, xfile *ast.File, path string, filenames []string, i int, imp types.Importer) error {
+	files := []*ast.File{xfile}
+	for j, filename := range filenames {
+		if j == i {
 			continue
 		}
-		// Yes it was.
-		// Was the last expr on the lhs of the assignment the same identifier
-		// tested in the if statement?
-		obj2 := lastObj(aStmt.Lhs, info)
-		if obj != obj2 {
-			continue
+		f, err := parser.ParseFile(xfset, filename, nil, 0)
+		if err != nil {
+			return err
 		}
-		// Yes it was. We have something like
-		//    ..., err := ..
-		//    if err != nil { ... }
-		n := len(newList)
-		// Make a new pseudo-statement that includes both the assignment
-		// and the test.
-		newStmt := errstmt.NewAssignIfErrStmt(aStmt, ifStmt)
-		if ifStmt.Init != nil {
-			ifStmt.Init = nil
-			newList[n-1] = newStmt
-		} else {
-			// The last two elements of newList are the assignment and if statements.
-			// Replace both with the new "statement".
-			newList[n-2] = newStmt
-			newList = newList[:n-1]
-		}
-	}
-	bs.List = newList
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: imp}
+	_, err := conf.Check(path, xfset, files, nil)
+	return err
 }
 
-// lastObj returns the types.Object for the last expression in exprs, if
-// it is an identifer. Otherwise it returns nil.
-func lastObj(exprs []ast.Expr, info *types.Info) types.Object {
-	if len(exprs) == 0 {
-		return nil
+// importPath returns the import path of the package bp. In a module, it is
+// the module path joined with the directory of bp relative to the module
+// root. Outside of one, it is the import path under GOPATH, or the package
+// name if bp is not in GOPATH either.
+func importPath(bp *build.Package) string {
+	if dir, err := filepath.Abs(bp.Dir); err == nil {
+		if root, mpath := findModule(dir); mpath != "" {
+			if rel, err := filepath.Rel(root, dir); err == nil {
+				if mpath == "std" {
+					// The standard library's import paths have no prefix.
+					return filepath.ToSlash(rel)
+				}
+				return path.Join(mpath, filepath.ToSlash(rel))
+			}
+		}
 	}
-	id, ok := exprs[len(exprs)-1].(*ast.Ident)
-	if !ok {
-		return nil
+	if bp.ImportPath == "" || bp.ImportPath == "." {
+		return bp.Name
 	}
-	return info.ObjectOf(id)
+	return bp.ImportPath
 }
 
-// onError reports whether expr is an inequality check between nil and
-// an identifier of type error. It also returns the Object associated
-// with the identifier.
-// Examples:
-//     err != nil
-//     !(err == nil)
-//	   nil != err
-//     ((err != nil))
-func onError(expr ast.Expr, info *types.Info) (types.Object, tribool) {
-	switch e := expr.(type) {
-	case *ast.BinaryExpr:
-		switch e.Op {
-		case token.EQL:
-			obj, t := errEqualsNil(e.X, e.Y, info)
-			return obj, not(t)
-		case token.NEQ:
-			return errEqualsNil(e.X, e.Y, info)
-		default:
-			return nil, Unknown
-		}
-	case *ast.ParenExpr:
-		return onError(e.X, info)
-	case *ast.UnaryExpr:
-		if e.Op == token.NOT {
-			obj, t := onError(e.X, info)
-			return obj, not(t)
-		}
-		return nil, Unknown
-
-	default:
-		return nil, Unknown
+// findModule returns the root directory and the path of the module
+// containing dir, or "" and "" if dir is not in a module.
+func findModule(dir string) (root, mpath string) {
+	for {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, modulePath(data)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
 	}
 }
 
-// errEqualsNil reports whether the two exprs are an identifier of type error and
-// nil. It returns the types.Object associated with the identifier.
-func errEqualsNil(e1, e2 ast.Expr, info *types.Info) (types.Object, tribool) {
-	t1 := info.TypeOf(e1)
-	t2 := info.TypeOf(e2)
-	var errExpr ast.Expr
-	if isErrorType(t1) && isNil(t2) {
-		errExpr = e1
-	} else if isErrorType(t2) && isNil(t1) {
-		errExpr = e2
-	}
-	if errExpr == nil {
-		return nil, False
-	}
-	if id, ok := errExpr.(*ast.Ident); ok {
-		return info.ObjectOf(id), True
+// modulePath returns the path in the module directive of the go.mod
+// contents data, or "" if there is none.
+func modulePath(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		if len(f) != 2 || f[0] != "module" {
+			continue
+		}
+		if p, err := strconv.Unquote(f[1]); err == nil {
+			return p
+		}
+		return f[1]
 	}
-	return nil, False
+	return ""
 }
 
-// isNil reports whether type t the "untyped nil" type
-func isNil(t types.Type) bool {
-	if b, ok := t.(*types.Basic); ok {
-		if b.Kind() == types.UntypedNil {
-			return true
+// processFile rewrites file and prints or writes the result. With -verify,
+// it also reports problems with the side notes, counting them in *nerrs;
+// check type-checks the expansion, if the package type-checked.
+func processFile(filename string, file *ast.File, fset *token.FileSet, info *types.Info, check func(*token.FileSet, *ast.File) error, nerrs *int) error {
+	_, sites := cfg.Rewrite(file, info)
+	if *verify {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		for _, p := range cfg.Verify(fset, file, src, info, sites, check) {
+			fmt.Fprintln(os.Stderr, p)
+			*nerrs++
 		}
 	}
-	return false
-}
+	var buf bytes.Buffer
+	fprint := cfg.Fprint
+	if *htmlOut {
+		fprint = cfg.FprintHTML
+	}
+	if err := fprint(&buf, fset, file); err != nil {
+		return err
+	}
+	res := buf.Bytes()
 
-// isErrorType reports whether t is the built-in error type.
-func isErrorType(t types.Type) bool {
-	nt, ok := t.(*types.Named)
-	if !ok {
-		return false
+	if *list && len(sites) > 0 {
+		fmt.Println(filename)
+	}
+	if *htmlOut && (*write || *outdir != "") {
+		// Each written file is a document of its own.
+		res = []byte(sidenote.HTMLHeader(filename) + string(res) + sidenote.HTMLFooter)
+	}
+	switch {
+	case *write:
+		return writeFile(filename, outputName(filename), res)
+	case *outdir != "":
+		out, err := mirrorName(*outdir, outputName(filename))
+		if err != nil {
+			return err
+		}
+		return writeFile(filename, out, res)
+	case *htmlOut && !*list:
+		fmt.Printf("<h2>%s</h2>\n", html.EscapeString(filename))
+		_, err := os.Stdout.Write(res)
+		return err
+	case !*list:
+		fmt.Printf("== file %s ==\n", filename)
+		_, err := os.Stdout.Write(res)
+		return err
 	}
-	tn := nt.Obj()
-	return tn.Pkg() == nil && tn.Name() == "error"
+	return nil
 }
 
-type tribool int
+// outputName returns the name of the file written for the source file filename.
+func outputName(filename string) string {
+	return strings.TrimSuffix(filename, ".go") + *ext
+}
 
-const (
-	Unknown tribool = iota
-	False
-	True
-)
+// mirrorName returns the path of filename in the tree rooted at dir.
+// Relative names are interpreted relative to the current directory;
+// filename must lie within it.
+func mirrorName(dir, filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New(filename + ": cannot mirror a file outside the current directory")
+	}
+	return filepath.Join(dir, rel), nil
+}
 
-func not(t tribool) tribool {
-	switch t {
-	case False:
-		return True
-	case True:
-		return False
+// writeFile writes data to the file out, with the permissions of the source file.
+func writeFile(src, out string, data []byte) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+		return err
 	}
-	return Unknown
+	return ioutil.WriteFile(out, data, fi.Mode().Perm())
 }
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"go/build"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jba/errside/internal/srcimporter"
+	"github.com/jba/errside/internal/testfiles"
+	"github.com/jba/errside/types"
+)
+
+func TestImportPath(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{
+		"go.mod":         "module example.com/m // comment\n\ngo 1.21\n",
+		"m.go":           "package m\n",
+		"a/b/b.go":       "package b\n",
+		"q/go.mod":       "module \"example.com/q\"\n",
+		"q/q.go":         "package q\n",
+		"q/main/main.go": "package main\n",
+	})
+	for _, test := range []struct {
+		dir, want string
+	}{
+		{".", "example.com/m"},
+		{"a/b", "example.com/m/a/b"},
+		{"q", "example.com/q"},
+		{"q/main", "example.com/q/main"},
+	} {
+		bp, err := build.ImportDir(filepath.Join(dir, filepath.FromSlash(test.dir)), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := importPath(bp); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.dir, got, test.want)
+		}
+	}
+}
+
+// Outside of a module and of GOPATH, the import path is the package name.
+func TestImportPathNoModule(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{"p.go": "package p\n"})
+	if _, mpath := findModule(dir); mpath != "" {
+		t.Skipf("%s is in module %s", dir, mpath)
+	}
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := importPath(bp); got != "p" {
+		t.Errorf("got %q, want %q", got, "p")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{
+		"go.mod":        "module example.com/m\n",
+		"a/a.go":        "package a\n",
+		"testdata/t.go": "package t\n",
+		"_x/x.go":       "package x\n",
+		"n/go.mod":      "module example.com/n\n",
+		"n/n.go":        "package n\n",
+		"n/sub/sub.go":  "package sub\n",
+	})
+	got, err := expand(filepath.Join(dir, "..."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{dir, filepath.Join(dir, "a")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// An external test package sees the identifiers that the internal test
+// files of the package under test export, also through packages that
+// depend on it.
+func TestExternalTest(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{
+		"go.mod":             "module example.com/m\n",
+		"sub/sub.go":         "package sub\n\ntype T int\n\nfunc f() (T, error) { return 0, nil }\n",
+		"sub/export_test.go": "package sub\n\nvar ExportF = f\n",
+		"dep/dep.go":         "package dep\n\nimport \"example.com/m/sub\"\n\nfunc Use(sub.T) {}\n",
+		"sub/sub_test.go": `package sub_test
+
+import (
+	"testing"
+
+	"example.com/m/dep"
+	"example.com/m/sub"
+)
+
+func TestF(t *testing.T) {
+	n, err := sub.ExportF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep.Use(n)
+}
+`,
+	})
+	defer func(w bool) { *write = w }(*write)
+	*write = true
+	imp = srcimporter.New(&ctxt, token.NewFileSet(), make(map[string]*types.Package))
+	// Import dep first, so that the importer holds the package under test
+	// without its test files.
+	if _, err := imp.ImportFrom("example.com/m/dep", dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := processDir(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "sub", "sub_test.goe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "n := sub.ExportF()"; !strings.Contains(string(got), want) {
+		t.Errorf("sub_test.goe does not contain %q:\n%s", want, got)
+	}
+}
+
+// processDirStderr runs processDir on dir, writing the results next to the
+// files, and returns what it printed on stderr and its error.
+func processDirStderr(t *testing.T, dir string) (string, error) {
+	t.Helper()
+	defer func(w bool) { *write = w }(*write)
+	*write = true
+	return processDirOutput(t, dir, &os.Stderr)
+}
+
+// processDirOutput runs processDir on dir with a fresh importer, and returns
+// what it printed on *out, os.Stdout or os.Stderr, and its error.
+func processDirOutput(t *testing.T, dir string, out **os.File) (string, error) {
+	t.Helper()
+	imp = srcimporter.New(&ctxt, token.NewFileSet(), make(map[string]*types.Package))
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(f *os.File) { *out = f }(*out)
+	*out = w
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	err = processDir(dir)
+	w.Close()
+	return <-done, err
+}
+
+// readResult returns the contents of the file written for the named file
+// in dir.
+func readResult(t *testing.T, dir, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, strings.TrimSuffix(name, ".go")+*ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+const foldable = `package p
+
+func g() (int, error) { return 0, nil }
+
+func ok() (int, error) {
+	n, err := g()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+`
+
+// A syntax error in one file is reported with its position, and the other
+// files of the package are still rewritten.
+func TestSyntaxError(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{
+		"go.mod": "module example.com/p\n",
+		"ok.go":  foldable,
+		"bad.go": "package p\n\nfunc bad() {\n\tx := \n}\n",
+	})
+	stderr, err := processDirStderr(t, dir)
+	if err == nil {
+		t.Error("got no error")
+	}
+	if want := filepath.Join(dir, "bad.go") + ":5:1: "; !strings.Contains(stderr, want) {
+		t.Errorf("stderr does not contain %q:\n%s", want, stderr)
+	}
+	if got, want := readResult(t, dir, "ok.go"), "n := g()"; !strings.Contains(got, want) {
+		t.Errorf("ok.goe does not contain %q:\n%s", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad"+*ext)); err == nil {
+		t.Error("bad.go was rewritten")
+	}
+}
+
+// A type error is reported, and the functions that could be checked are
+// still rewritten.
+func TestTypeError(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{
+		"go.mod": "module example.com/p\n",
+		"ok.go":  foldable,
+		"bad.go": "package p\n\nfunc bad() int {\n\treturn undefined\n}\n",
+	})
+	stderr, err := processDirStderr(t, dir)
+	if err == nil {
+		t.Error("got no error")
+	}
+	if want := "undefined: undefined"; !strings.Contains(stderr, want) {
+		t.Errorf("stderr does not contain %q:\n%s", want, stderr)
+	}
+	if got, want := readResult(t, dir, "ok.go"), "n := g()"; !strings.Contains(got, want) {
+		t.Errorf("ok.goe does not contain %q:\n%s", want, got)
+	}
+}
+
+// With -l, the files in which side notes would be introduced are listed,
+// and nothing else is printed or written.
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{
+		"go.mod":  "module example.com/p\n",
+		"ok.go":   foldable,
+		"none.go": "package p\n\nfunc none() int { return 0 }\n",
+	})
+	defer func(l bool) { *list = l }(*list)
+	*list = true
+	stdout, err := processDirOutput(t, dir, &os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "ok.go") + "\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ok"+*ext)); err == nil {
+		t.Error("ok.go was rewritten")
+	}
+}
+
+// With -o, the results are written to a mirror of the source tree, and
+// nothing is printed or written next to the sources.
+func TestOutdir(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{
+		"src/go.mod":  "module example.com/p\n",
+		"src/a/ok.go": strings.Replace(foldable, "package p", "package a", 1),
+	})
+	t.Chdir(dir)
+	defer func(o string) { *outdir = o }(*outdir)
+	*outdir = "out"
+	stdout, err := processDirOutput(t, filepath.Join("src", "a"), &os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout != "" {
+		t.Errorf("printed %q", stdout)
+	}
+	if got, want := readResult(t, filepath.Join(dir, "out", "src", "a"), "ok.go"), "n := g()"; !strings.Contains(got, want) {
+		t.Errorf("out/src/a/ok.goe does not contain %q:\n%s", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "src", "a", "ok"+*ext)); err == nil {
+		t.Error("ok.goe was written next to ok.go")
+	}
+
+	// An absolute name within the current directory is mirrored like a
+	// relative one; a name outside of it cannot be mirrored.
+	for _, test := range []struct {
+		filename, want string
+	}{
+		{filepath.Join(dir, "src", "b.goe"), filepath.Join("out", "src", "b.goe")},
+		{"c.goe", filepath.Join("out", "c.goe")},
+		{filepath.Join("..", "x.goe"), ""},
+		{filepath.Join(filepath.Dir(dir), "x.goe"), ""},
+	} {
+		got, err := mirrorName("out", test.filename)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: got %q, want error", test.filename, got)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("%s: got %q, %v, want %q", test.filename, got, err, test.want)
+		}
+	}
+}
@@ -9,26 +9,230 @@ import (
 type AssignIfErrStmt struct {
 	FirstStmt ast.Stmt
 	IfStmt    *ast.IfStmt
-	ErrVar    *ast.Ident // the error variable != nil
-	IsShort   bool       // short assignment?
+	ErrVar    ast.Expr // the error variable != nil: an identifier, or a selector, index or pointer indirection
+	IsShort   bool     // short assignment?
+	IsInit    bool     // assignment was the init statement of IfStmt?
+	CommaOk   bool     // ErrVar is the boolean result of a comma-ok expression, tested with !ok
+
+	// Inverted is set if IfStmt tests that ErrVar is nil. Its body is then
+	// the success branch, and its else branch or, if it has none, After is
+	// the error branch. See ErrIf.
+	Inverted bool
+	After    ast.Stmt // the statement following IfStmt, if it is the error branch
 }
 
+// NewAssignIfErrStmt combines aStmt and iStmt into a single statement.
+// If aStmt is the init statement of iStmt, it is removed from iStmt.
+// The last expression on the left-hand side of aStmt is the error variable;
+// it is removed from aStmt.
 func NewAssignIfErrStmt(aStmt *ast.AssignStmt, iStmt *ast.IfStmt) *AssignIfErrStmt {
-	llen := len(aStmt.Lhs)
 	a := &AssignIfErrStmt{
-		IfStmt:  iStmt,
-		ErrVar:  aStmt.Lhs[llen-1].(*ast.Ident),
-		IsShort: aStmt.Tok == token.DEFINE,
+		IfStmt: iStmt,
+		IsInit: iStmt.Init == ast.Stmt(aStmt),
 	}
-	if len(aStmt.Lhs) > 1 {
-		aStmt.Lhs = aStmt.Lhs[:llen-1]
-		a.FirstStmt = aStmt
-	} else {
-		a.FirstStmt = &ast.ExprStmt{X: aStmt.Rhs[0]}
+	if a.IsInit {
+		iStmt.Init = nil
 	}
+	a.FirstStmt, a.ErrVar, a.IsShort = split(aStmt)
 	return a
 }
 
 func (a *AssignIfErrStmt) Pos() token.Pos { return a.FirstStmt.Pos() }
-func (a *AssignIfErrStmt) End() token.Pos { return a.IfStmt.End() }
-func (*AssignIfErrStmt) StmtNode()        {}
+func (a *AssignIfErrStmt) End() token.Pos {
+	if a.After != nil {
+		return a.After.End()
+	}
+	return a.IfStmt.End()
+}
+func (*AssignIfErrStmt) StmtNode() {}
+
+// Children implements ast.ExternalNode.
+func (a *AssignIfErrStmt) Children() []ast.Node {
+	if a.After != nil {
+		return []ast.Node{a.FirstStmt, a.ErrVar, a.IfStmt, a.After}
+	}
+	return []ast.Node{a.FirstStmt, a.ErrVar, a.IfStmt}
+}
+
+// ErrIf returns the if statement that handles the error. Unless a is
+// Inverted, that is IfStmt. Otherwise it is a new if statement that tests
+// ErrVar != nil and whose body is the error branch: the else branch of
+// IfStmt or a block holding After. The new statement runs the error branch
+// in the same cases as IfStmt, but not the success branch; that must be
+// run after it.
+func (a *AssignIfErrStmt) ErrIf() *ast.IfStmt {
+	if !a.Inverted {
+		return a.IfStmt
+	}
+	body, _ := a.IfStmt.Else.(*ast.BlockStmt)
+	if body == nil {
+		body = &ast.BlockStmt{Lbrace: a.After.Pos(), List: []ast.Stmt{a.After}, Rbrace: a.After.End()}
+	}
+	return &ast.IfStmt{
+		If:   a.IfStmt.If,
+		Cond: &ast.BinaryExpr{X: a.ErrVar, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+		Body: body,
+	}
+}
+
+// Assign returns the assignment that a replaced, with the error
+// variable restored as the last element of its left-hand side.
+// The result is a new node; a is not modified.
+func (a *AssignIfErrStmt) Assign() *ast.AssignStmt {
+	return assign(a.FirstStmt, a.ErrVar, a.IsShort)
+}
+
+// Expand returns the standard Go statements that a replaced: either an
+// assignment followed by an if statement, or, if IsInit is set, a single
+// if statement with the assignment as its init statement. If After is set,
+// it follows the if statement.
+// The results are new nodes; a is not modified.
+func (a *AssignIfErrStmt) Expand() []ast.Stmt {
+	as := a.Assign()
+	ifStmt := *a.IfStmt
+	var list []ast.Stmt
+	if a.IsInit {
+		ifStmt.Init = as
+		list = []ast.Stmt{&ifStmt}
+	} else {
+		list = []ast.Stmt{as, &ifStmt}
+	}
+	if a.After != nil {
+		list = append(list, a.After)
+	}
+	return list
+}
+
+// An AssignSwitchErrStmt combines an assignment to an error variable
+// with the expression switch that dispatches on it, either by using the
+// variable as its tag or by testing it in its cases.
+type AssignSwitchErrStmt struct {
+	FirstStmt  ast.Stmt
+	SwitchStmt *ast.SwitchStmt
+	ErrVar     ast.Expr // the error variable
+	IsShort    bool     // short assignment?
+	IsInit     bool     // assignment was the init statement of SwitchStmt?
+}
+
+// NewAssignSwitchErrStmt combines aStmt and sStmt into a single statement,
+// like NewAssignIfErrStmt.
+func NewAssignSwitchErrStmt(aStmt *ast.AssignStmt, sStmt *ast.SwitchStmt) *AssignSwitchErrStmt {
+	a := &AssignSwitchErrStmt{
+		SwitchStmt: sStmt,
+		IsInit:     sStmt.Init == ast.Stmt(aStmt),
+	}
+	if a.IsInit {
+		sStmt.Init = nil
+	}
+	a.FirstStmt, a.ErrVar, a.IsShort = split(aStmt)
+	return a
+}
+
+func (a *AssignSwitchErrStmt) Pos() token.Pos { return a.FirstStmt.Pos() }
+func (a *AssignSwitchErrStmt) End() token.Pos { return a.SwitchStmt.End() }
+func (*AssignSwitchErrStmt) StmtNode()        {}
+
+// Children implements ast.ExternalNode.
+func (a *AssignSwitchErrStmt) Children() []ast.Node {
+	return []ast.Node{a.FirstStmt, a.ErrVar, a.SwitchStmt}
+}
+
+// Assign returns the assignment that a replaced, with the error
+// variable restored as the last element of its left-hand side.
+// The result is a new node; a is not modified.
+func (a *AssignSwitchErrStmt) Assign() *ast.AssignStmt {
+	return assign(a.FirstStmt, a.ErrVar, a.IsShort)
+}
+
+// Expand returns the standard Go statements that a replaced: either an
+// assignment followed by a switch statement, or, if IsInit is set, a
+// single switch statement with the assignment as its init statement.
+// The results are new nodes; a is not modified.
+func (a *AssignSwitchErrStmt) Expand() []ast.Stmt {
+	as := a.Assign()
+	sw := *a.SwitchStmt
+	if a.IsInit {
+		sw.Init = as
+		return []ast.Stmt{&sw}
+	}
+	return []ast.Stmt{as, &sw}
+}
+
+// IsStmtExpr reports whether x may stand alone as an expression statement:
+// whether it is a call or a receive operation. Only then can a side note
+// follow x itself, as in "f() = err; if ...": for any other x, that text is
+// an ordinary assignment to x followed by an if statement.
+func IsStmtExpr(x ast.Expr) bool {
+	switch x := ast.Unparen(x).(type) {
+	case *ast.CallExpr:
+		return true
+	case *ast.UnaryExpr:
+		return x.Op == token.ARROW
+	}
+	return false
+}
+
+// split removes the last expression from the left-hand side of aStmt
+// and returns the remaining statement, the removed expression, and
+// whether aStmt was a short variable declaration. If nothing remains
+// on the left-hand side, the statement is the right-hand side alone.
+func split(aStmt *ast.AssignStmt) (first ast.Stmt, errVar ast.Expr, isShort bool) {
+	llen := len(aStmt.Lhs)
+	errVar = aStmt.Lhs[llen-1]
+	isShort = aStmt.Tok == token.DEFINE
+	if llen > 1 {
+		aStmt.Lhs = aStmt.Lhs[:llen-1]
+		return aStmt, errVar, isShort
+	}
+	return &ast.ExprStmt{X: aStmt.Rhs[0]}, errVar, isShort
+}
+
+// assign is the inverse of split. The error variable is placed where the
+// left-hand side of first ends, or where first starts if it has none: a
+// side note may start on the line after its statement, and the variable
+// must not take the printer there.
+func assign(first ast.Stmt, errVar ast.Expr, isShort bool) *ast.AssignStmt {
+	tok := token.ASSIGN
+	if isShort {
+		tok = token.DEFINE
+	}
+	switch s := first.(type) {
+	case *ast.AssignStmt:
+		lhs := make([]ast.Expr, len(s.Lhs), len(s.Lhs)+1)
+		copy(lhs, s.Lhs)
+		return &ast.AssignStmt{
+			Lhs:    append(lhs, moveTo(errVar, s.Lhs[len(s.Lhs)-1].End())),
+			TokPos: s.TokPos,
+			Tok:    s.Tok,
+			Rhs:    s.Rhs,
+		}
+	case *ast.ExprStmt:
+		return &ast.AssignStmt{
+			Lhs:    []ast.Expr{moveTo(errVar, s.Pos())},
+			TokPos: s.Pos(),
+			Tok:    tok,
+			Rhs:    []ast.Expr{s.X},
+		}
+	}
+	panic("errstmt: unexpected first statement")
+}
+
+// moveTo returns a copy of the error variable e with all its positions set
+// to pos. Expressions that cannot be error variables are returned as is.
+func moveTo(e ast.Expr, pos token.Pos) ast.Expr {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return &ast.Ident{NamePos: pos, Name: e.Name}
+	case *ast.BasicLit:
+		return &ast.BasicLit{ValuePos: pos, Kind: e.Kind, Value: e.Value}
+	case *ast.ParenExpr:
+		return &ast.ParenExpr{Lparen: pos, X: moveTo(e.X, pos), Rparen: pos}
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: moveTo(e.X, pos), Sel: moveTo(e.Sel, pos).(*ast.Ident)}
+	case *ast.StarExpr:
+		return &ast.StarExpr{Star: pos, X: moveTo(e.X, pos)}
+	case *ast.IndexExpr:
+		return &ast.IndexExpr{X: moveTo(e.X, pos), Lbrack: pos, Index: moveTo(e.Index, pos), Rbrack: pos}
+	}
+	return e
+}
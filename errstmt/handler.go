@@ -0,0 +1,177 @@
+package errstmt
+
+import (
+	"go/token"
+
+	"github.com/jba/errside/ast"
+)
+
+// A HandlerKind classifies the error branch of a side note.
+type HandlerKind int
+
+const (
+	Custom    HandlerKind = iota // anything else
+	Propagate                    // "return err", with zero values for any other results
+	Wrap                         // "return fmt.Errorf(...)" with the error as an argument
+	Log                          // "log.Print(...)", after which execution continues
+	Fatal                        // "log.Fatal(...)", "log.Panic(...)" or "panic(...)"
+	Loop                         // "continue" or "break"
+)
+
+var kindNames = [...]string{
+	Custom:    "custom",
+	Propagate: "propagate",
+	Wrap:      "wrap",
+	Log:       "log",
+	Fatal:     "fatal",
+	Loop:      "loop",
+}
+
+func (k HandlerKind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "HandlerKind(?)"
+	}
+	return kindNames[k]
+}
+
+// Kind classifies the error branch of a, the body of ErrIf. All kinds but
+// Custom have a body of a single statement and a plain condition: one that
+// is true exactly when ErrVar is not nil, such as "ErrVar != nil",
+// "nil != ErrVar" or "!(ErrVar == nil)", or "!ErrVar" if a.CommaOk. A
+// branch that handles only some errors is Custom. The classification is
+// syntactic: fmt and log are assumed to name the standard packages.
+func (a *AssignIfErrStmt) Kind() HandlerKind {
+	sif := a.ErrIf()
+	if sif.Else != nil || len(sif.Body.List) != 1 || !a.isPlainCond(sif.Cond) {
+		return Custom
+	}
+	switch s := sif.Body.List[0].(type) {
+	case *ast.ReturnStmt:
+		if a.CommaOk || len(s.Results) == 0 {
+			return Custom
+		}
+		for _, r := range s.Results[:len(s.Results)-1] {
+			if !isZero(r) {
+				return Custom
+			}
+		}
+		last := s.Results[len(s.Results)-1]
+		if sameExpr(last, a.ErrVar) {
+			return Propagate
+		}
+		if call, ok := last.(*ast.CallExpr); ok && isPkgFunc(call.Fun, "fmt", "Errorf") {
+			for _, arg := range call.Args {
+				if sameExpr(arg, a.ErrVar) {
+					return Wrap
+				}
+			}
+		}
+	case *ast.ExprStmt:
+		call, ok := s.X.(*ast.CallExpr)
+		if !ok {
+			return Custom
+		}
+		switch {
+		case isPkgFunc(call.Fun, "log", "Print", "Printf", "Println"):
+			return Log
+		case isPkgFunc(call.Fun, "log", "Fatal", "Fatalf", "Fatalln", "Panic", "Panicf", "Panicln"):
+			return Fatal
+		}
+		if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "panic" {
+			return Fatal
+		}
+	case *ast.BranchStmt:
+		if s.Tok == token.CONTINUE || s.Tok == token.BREAK {
+			return Loop
+		}
+	}
+	return Custom
+}
+
+// isPlainCond reports whether cond is true exactly when ErrVar is not nil:
+// whether it is "ErrVar != nil" or "nil != ErrVar", possibly negated from
+// "==" and parenthesized, or "!ErrVar" if a.CommaOk.
+func (a *AssignIfErrStmt) isPlainCond(cond ast.Expr) bool {
+	cond = ast.Unparen(cond)
+	u, ok := cond.(*ast.UnaryExpr)
+	if a.CommaOk {
+		return ok && u.Op == token.NOT && sameExpr(u.X, a.ErrVar)
+	}
+	if ok && u.Op == token.NOT {
+		return a.isNilComparison(u.X, token.EQL)
+	}
+	return a.isNilComparison(cond, token.NEQ)
+}
+
+// isNilComparison reports whether x compares ErrVar with nil using op, in
+// either order.
+func (a *AssignIfErrStmt) isNilComparison(x ast.Expr, op token.Token) bool {
+	b, ok := ast.Unparen(x).(*ast.BinaryExpr)
+	if !ok || b.Op != op {
+		return false
+	}
+	return sameExpr(b.X, a.ErrVar) && isNilIdent(b.Y) || isNilIdent(b.X) && sameExpr(b.Y, a.ErrVar)
+}
+
+// isNilIdent reports whether e is the identifier nil.
+func isNilIdent(e ast.Expr) bool {
+	id, ok := ast.Unparen(e).(*ast.Ident)
+	return ok && id.Name == "nil"
+}
+
+// isPkgFunc reports whether fun is pkg.name for one of names.
+func isPkgFunc(fun ast.Expr, pkg string, names ...string) bool {
+	sel, ok := fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	if id, ok := sel.X.(*ast.Ident); !ok || id.Name != pkg {
+		return false
+	}
+	for _, n := range names {
+		if sel.Sel.Name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// isZero reports whether e is written as a zero value: nil, false, 0, an
+// empty string or an empty composite literal.
+func isZero(e ast.Expr) bool {
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		return e.Name == "nil" || e.Name == "false"
+	case *ast.BasicLit:
+		switch e.Value {
+		case "0", "0.0", `""`, "``":
+			return true
+		}
+	case *ast.CompositeLit:
+		return len(e.Elts) == 0
+	}
+	return false
+}
+
+// sameExpr reports whether x and y are the same variable expression.
+func sameExpr(x, y ast.Expr) bool {
+	x, y = ast.Unparen(x), ast.Unparen(y)
+	switch x := x.(type) {
+	case *ast.Ident:
+		y, ok := y.(*ast.Ident)
+		return ok && x.Name == y.Name
+	case *ast.SelectorExpr:
+		y, ok := y.(*ast.SelectorExpr)
+		return ok && x.Sel.Name == y.Sel.Name && sameExpr(x.X, y.X)
+	case *ast.StarExpr:
+		y, ok := y.(*ast.StarExpr)
+		return ok && sameExpr(x.X, y.X)
+	case *ast.IndexExpr:
+		y, ok := y.(*ast.IndexExpr)
+		return ok && sameExpr(x.X, y.X) && sameExpr(x.Index, y.Index)
+	case *ast.BasicLit:
+		y, ok := y.(*ast.BasicLit)
+		return ok && x.Kind == y.Kind && x.Value == y.Value
+	}
+	return false
+}
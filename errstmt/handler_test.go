@@ -0,0 +1,59 @@
+package errstmt_test
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/errstmt"
+	"github.com/jba/errside/parser"
+)
+
+func TestKind(t *testing.T) {
+	for _, test := range []struct {
+		note string // a side note in the body of a function
+		want errstmt.HandlerKind
+	}{
+		{`n := f() =: err; if err != nil { return 0, err }`, errstmt.Propagate},
+		{`n := f() =: err; if err != nil { return 0, fmt.Errorf("f: %w", err) }`, errstmt.Wrap},
+		{`f() =: err if err != nil { log.Print(err) }`, errstmt.Log},
+		{`f() =: err if err != nil { log.Fatal(err) }`, errstmt.Fatal},
+		{`f() =: err if err != nil { panic(err) }`, errstmt.Fatal},
+		{`f() =: err if err != nil { continue }`, errstmt.Loop},
+		{`v := m[k] =: ok; if !ok { continue }`, errstmt.Loop},
+		{`n := f() =: err; if err != nil { return 1, err }`, errstmt.Custom},
+		{`n := f() =: err; if err != nil { log.Print(err); return 0, err }`, errstmt.Custom},
+		{`v := m[k] =: ok; if !ok { return 0, nil }`, errstmt.Custom},
+
+		// Other ways of writing the plain condition.
+		{`n := f() =: err; if nil != err { return 0, err }`, errstmt.Propagate},
+		{`n := f() =: err; if !(err == nil) { return 0, fmt.Errorf("f: %v", err) }`, errstmt.Wrap},
+		{`n := f() =: err; if !(nil == err) { return 0, err }`, errstmt.Propagate},
+		{`n := f() =: err; if (err != nil) { return 0, err }`, errstmt.Propagate},
+		{`v := m[k] =: ok; if (!ok) { continue }`, errstmt.Loop},
+
+		// Conditions that handle only some errors.
+		{`n := f() =: err; if err != nil && err != io.EOF { return 0, err }`, errstmt.Custom},
+		{`n := f() =: err; if ok && err != nil { return 0, err }`, errstmt.Custom},
+		{`n := f() =: err; if err == nil { return 0, err }`, errstmt.Custom},
+		{`n := f() =: err; if !(err != nil) { return 0, err }`, errstmt.Custom},
+		{`n := f() =: err; if err != io.EOF { return 0, err }`, errstmt.Custom},
+		{`v := m[k] =: ok; if !ok && k != "" { continue }`, errstmt.Custom},
+	} {
+		src := "package p\nfunc _() {\n" + test.note + "\n}\n"
+		file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SideNotes)
+		if err != nil {
+			t.Fatalf("%s: %v", test.note, err)
+		}
+		s, ok := file.Decls[0].(*ast.FuncDecl).Body.List[0].(*errstmt.AssignIfErrStmt)
+		if !ok {
+			t.Fatalf("%s: not a side note", test.note)
+		}
+		// The rewriter, not the parser, knows which side notes test a
+		// comma-ok result.
+		s.CommaOk = s.ErrVar.(*ast.Ident).Name == "ok"
+		if got := s.Kind(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.note, got, test.want)
+		}
+	}
+}
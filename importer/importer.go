@@ -6,11 +6,14 @@
 package importer
 
 import (
+	"go/build"
+	"go/token"
 	"io"
 	"runtime"
 
 	"github.com/jba/errside/internal/gccgoimporter"
 	"github.com/jba/errside/internal/gcimporter"
+	"github.com/jba/errside/internal/srcimporter"
 	"github.com/jba/errside/types"
 )
 
@@ -19,31 +22,51 @@ import (
 type Lookup func(path string) (io.ReadCloser, error)
 
 // For returns an Importer for the given compiler and lookup interface,
-// or nil. Supported compilers are "gc", and "gccgo". If lookup is nil,
-// the default package lookup mechanism for the given compiler is used.
-// BUG(issue13847): For does not support non-nil lookup functions.
+// or nil. Supported compilers are "gc", "gccgo", and "source". If lookup
+// is nil, the default package lookup mechanism for the given compiler is used,
+// and the resulting importer attempts to resolve relative and absolute import
+// paths to canonical import path IDs before finding the imported file.
+//
+// If lookup is non-nil, then the returned importer calls lookup each time
+// it needs to resolve an import path. In this mode the importer can only be
+// invoked with canonical import paths (not relative or absolute ones); it is
+// assumed that the translation to canonical import paths is being done by the
+// client of the importer. The gccgo importer requires lookup to return an
+// io.ReadSeeker.
+//
+// The "source" importer type-checks packages from their source files,
+// resolving import paths through go.mod and go.sum files, vendor
+// directories, the module cache and GOPATH. Packages are cached per
+// importer. Its lookup must be nil.
 func For(compiler string, lookup Lookup) types.Importer {
 	switch compiler {
 	case "gc":
-		if lookup != nil {
-			panic("gc importer for custom import path lookup not yet implemented")
+		return &gcimports{
+			packages: make(map[string]*types.Package),
+			lookup:   lookup,
 		}
 
-		return make(gcimports)
-
 	case "gccgo":
-		if lookup != nil {
-			panic("gccgo importer for custom import path lookup not yet implemented")
-		}
-
 		var inst gccgoimporter.GccgoInstallation
-		if err := inst.InitFromDriver("gccgo"); err != nil {
-			return nil
+		if lookup == nil {
+			// The installation provides the search paths;
+			// with a custom lookup none are needed.
+			if err := inst.InitFromDriver("gccgo"); err != nil {
+				return nil
+			}
 		}
 		return &gccgoimports{
 			packages: make(map[string]*types.Package),
 			importer: inst.GetImporter(nil, nil),
+			lookup:   lookup,
 		}
+
+	case "source":
+		if lookup != nil {
+			panic("source importer for custom import path lookup not supported (issue #13847).")
+		}
+
+		return srcimporter.New(&build.Default, token.NewFileSet(), make(map[string]*types.Package))
 	}
 
 	// compiler not supported
@@ -58,17 +81,20 @@ func Default() types.Importer {
 
 // gc support
 
-type gcimports map[string]*types.Package
+type gcimports struct {
+	packages map[string]*types.Package
+	lookup   Lookup
+}
 
-func (m gcimports) Import(path string) (*types.Package, error) {
+func (m *gcimports) Import(path string) (*types.Package, error) {
 	return m.ImportFrom(path, "" /* no vendoring */, 0)
 }
 
-func (m gcimports) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+func (m *gcimports) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
 	if mode != 0 {
 		panic("mode must be 0")
 	}
-	return gcimporter.Import(m, path, srcDir)
+	return gcimporter.Import(m.packages, path, srcDir, m.lookup)
 }
 
 // gccgo support
@@ -76,6 +102,7 @@ func (m gcimports) ImportFrom(path, srcDir string, mode types.ImportMode) (*type
 type gccgoimports struct {
 	packages map[string]*types.Package
 	importer gccgoimporter.Importer
+	lookup   Lookup
 }
 
 func (m *gccgoimports) Import(path string) (*types.Package, error) {
@@ -86,6 +113,5 @@ func (m *gccgoimports) ImportFrom(path, srcDir string, mode types.ImportMode) (*
 	if mode != 0 {
 		panic("mode must be 0")
 	}
-	// TODO(gri) pass srcDir
-	return m.importer(m.packages, path)
+	return m.importer(m.packages, path, srcDir, m.lookup)
 }
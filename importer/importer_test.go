@@ -0,0 +1,152 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/jba/errside/types"
+)
+
+// gcExportData returns a minimal gc object file for package p,
+// declaring a single variable V of type int.
+func gcExportData() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("go object linux amd64 go1.10 X:none\n$$B\n")
+	buf.WriteString("version 4\n\n") // non-debug format
+	ints := func(xs ...int64) {
+		for _, x := range xs {
+			var b [binary.MaxVarintLen64]byte
+			buf.Write(b[:binary.PutVarint(b[:], x)])
+		}
+	}
+	ints(0, 0)           // trackAllTypes, posInfoFormat
+	ints(-1, -1)         // packageTag, len("p")
+	buf.WriteString("p") // package name
+	ints(0)              // package path ""
+	ints(-4, -1)         // varTag, len("V")
+	buf.WriteString("V") // object name
+	ints(0, 1)           // package index, predeclared int
+	ints(-6, 1)          // endTag, object count
+	return buf.Bytes()
+}
+
+// readSeekCloser turns a *strings.Reader into an io.ReadCloser
+// that also implements io.Seeker, as the gccgo importer requires.
+type readSeekCloser struct {
+	*strings.Reader
+}
+
+func (readSeekCloser) Close() error { return nil }
+
+func checkV(t *testing.T, pkg *types.Package) {
+	t.Helper()
+	if pkg.Path() != "p" || pkg.Name() != "p" {
+		t.Errorf("got package %q (%s), want %q (p)", pkg.Path(), pkg.Name(), "p")
+	}
+	v := pkg.Scope().Lookup("V")
+	if v == nil {
+		t.Fatal("V not found")
+	}
+	if got, want := v.Type(), types.Typ[types.Int]; got != want {
+		t.Errorf("V has type %v, want %v", got, want)
+	}
+}
+
+func TestForGcLookup(t *testing.T) {
+	var paths []string
+	imp := For("gc", func(path string) (io.ReadCloser, error) {
+		paths = append(paths, path)
+		if path != "p" {
+			return nil, errors.New("not found")
+		}
+		return ioutil.NopCloser(bytes.NewReader(gcExportData())), nil
+	})
+
+	pkg, err := imp.Import("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkV(t, pkg)
+
+	// A completely imported package is not looked up again.
+	pkg2, err := imp.Import("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg2 != pkg {
+		t.Error("second import returned a different package")
+	}
+
+	// Package unsafe is known without a lookup.
+	if pkg, err := imp.Import("unsafe"); err != nil || pkg != types.Unsafe {
+		t.Errorf("importing unsafe: got %v, %v", pkg, err)
+	}
+
+	// Lookup errors are reported.
+	if _, err := imp.Import("q"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("importing q: got error %v, want lookup error", err)
+	}
+
+	if got, want := strings.Join(paths, " "), "p q"; got != want {
+		t.Errorf("looked up %q, want %q", got, want)
+	}
+}
+
+func TestForGcLookupBadData(t *testing.T) {
+	imp := For("gc", func(path string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("not an object file\n")), nil
+	})
+	_, err := imp.Import("p")
+	if err == nil || !strings.Contains(err.Error(), "<lookup p>") {
+		t.Errorf("got error %v, want error mentioning <lookup p>", err)
+	}
+}
+
+const gccgoExportData = `v1;
+package p;
+pkgpath p;
+var V <type -11>;
+`
+
+func TestForGccgoLookup(t *testing.T) {
+	var paths []string
+	imp := For("gccgo", func(path string) (io.ReadCloser, error) {
+		paths = append(paths, path)
+		return readSeekCloser{strings.NewReader(gccgoExportData)}, nil
+	})
+	if imp == nil {
+		t.Fatal("For returned nil")
+	}
+
+	pkg, err := imp.Import("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkV(t, pkg)
+
+	if pkg2, err := imp.Import("p"); err != nil || pkg2 != pkg {
+		t.Errorf("second import: got %v, %v; want the first package", pkg2, err)
+	}
+	if got, want := strings.Join(paths, " "), "p"; got != want {
+		t.Errorf("looked up %q, want %q", got, want)
+	}
+}
+
+func TestForGccgoLookupNotSeeker(t *testing.T) {
+	imp := For("gccgo", func(path string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(gccgoExportData)), nil
+	})
+	_, err := imp.Import("p")
+	if err == nil || !strings.Contains(err.Error(), "io.ReadSeeker") {
+		t.Errorf("got error %v, want error about io.ReadSeeker", err)
+	}
+}
@@ -40,8 +40,12 @@ func readGopackHeader(r *bufio.Reader) (name string, size int, err error) {
 // file by reading from it. The reader must be positioned at the
 // start of the file before calling this function. The hdr result
 // is the string before the export data, either "$$" or "$$B".
+// The size result is the number of bytes of export data that follow,
+// including the end-of-section marker "\n$$\n", or -1 if r does not
+// hold an archive and the size is therefore unknown.
 //
-func FindExportData(r *bufio.Reader) (hdr string, err error) {
+func FindExportData(r *bufio.Reader) (hdr string, size int, err error) {
+	size = -1
 	// Read first line to make sure this is an object file.
 	line, err := r.ReadSlice('\n')
 	if err != nil {
@@ -52,7 +56,7 @@ func FindExportData(r *bufio.Reader) (hdr string, err error) {
 	if string(line) == "!<arch>\n" {
 		// Archive file. Scan to __.PKGDEF.
 		var name string
-		if name, _, err = readGopackHeader(r); err != nil {
+		if name, size, err = readGopackHeader(r); err != nil {
 			return
 		}
 
@@ -79,13 +83,22 @@ func FindExportData(r *bufio.Reader) (hdr string, err error) {
 
 	// Skip over object header to export data.
 	// Begins after first line starting with $$.
+	if size >= 0 {
+		size -= len(line)
+	}
 	for line[0] != '$' {
 		if line, err = r.ReadSlice('\n'); err != nil {
 			err = fmt.Errorf("can't find export data (%v)", err)
 			return
 		}
+		if size >= 0 {
+			size -= len(line)
+		}
 	}
 	hdr = string(line)
+	if size < -1 {
+		err = fmt.Errorf("invalid size in archive header")
+	}
 
 	return
 }
@@ -7,9 +7,11 @@ package gcimporter
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"go/build"
 	"go/token"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -83,29 +85,53 @@ func FindPkg(path, srcDir string) (filename, id string) {
 // Import imports a gc-generated package given its import path and srcDir, adds
 // the corresponding package object to the packages map, and returns the object.
 // The packages map must contain all packages already imported.
+// If lookup is non-nil, it is used to obtain the export data for path
+// instead of locating an object file; srcDir is ignored in that case.
 //
-func Import(packages map[string]*types.Package, path, srcDir string) (pkg *types.Package, err error) {
-	filename, id := FindPkg(path, srcDir)
-	if filename == "" {
+func Import(packages map[string]*types.Package, path, srcDir string, lookup func(path string) (io.ReadCloser, error)) (pkg *types.Package, err error) {
+	var rc io.ReadCloser
+	var filename, id string
+	if lookup != nil {
+		// With custom lookup specified, assume that caller has
+		// converted path to a canonical import path for use in the map.
 		if path == "unsafe" {
 			return types.Unsafe, nil
 		}
-		err = fmt.Errorf("can't find import: %s", id)
-		return
-	}
+		id = path
 
-	// no need to re-import if the package was imported completely before
-	if pkg = packages[id]; pkg != nil && pkg.Complete() {
-		return
-	}
+		// No need to re-import if the package was imported completely before.
+		if pkg = packages[id]; pkg != nil && pkg.Complete() {
+			return
+		}
+		f, err := lookup(path)
+		if err != nil {
+			return nil, err
+		}
+		rc = f
+		filename = fmt.Sprintf("<lookup %s>", path)
+	} else {
+		filename, id = FindPkg(path, srcDir)
+		if filename == "" {
+			if path == "unsafe" {
+				return types.Unsafe, nil
+			}
+			return nil, fmt.Errorf("can't find import: %s", id)
+		}
 
-	// open file
-	f, err := os.Open(filename)
-	if err != nil {
-		return
+		// no need to re-import if the package was imported completely before
+		if pkg = packages[id]; pkg != nil && pkg.Complete() {
+			return
+		}
+
+		// open file
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		rc = f
 	}
 	defer func() {
-		f.Close()
+		rc.Close()
 		if err != nil {
 			// add file name to error
 			err = fmt.Errorf("%s: %v", filename, err)
@@ -113,8 +139,9 @@ func Import(packages map[string]*types.Package, path, srcDir string) (pkg *types
 	}()
 
 	var hdr string
-	buf := bufio.NewReader(f)
-	if hdr, err = FindExportData(buf); err != nil {
+	var size int
+	buf := bufio.NewReader(rc)
+	if hdr, size, err = FindExportData(buf); err != nil {
 		return
 	}
 
@@ -123,14 +150,38 @@ func Import(packages map[string]*types.Package, path, srcDir string) (pkg *types
 		err = fmt.Errorf("import %q: old export format no longer supported (recompile library)", path)
 	case "$$B\n":
 		var data []byte
-		data, err = ioutil.ReadAll(buf)
-		if err == nil {
-			// TODO(gri): allow clients of go/importer to provide a FileSet.
-			// Or, define a new standard go/types/gcexportdata package.
-			fset := token.NewFileSet()
-			_, pkg, err = BImportData(fset, packages, data, id)
+		if size >= 0 {
+			data = make([]byte, size)
+			_, err = io.ReadFull(buf, data)
+		} else {
+			data, err = ioutil.ReadAll(buf)
+		}
+		if err != nil {
 			return
 		}
+
+		// TODO(gri): allow clients of go/importer to provide a FileSet.
+		// Or, define a new standard go/types/gcexportdata package.
+		fset := token.NewFileSet()
+
+		// The first byte of the export data identifies its format:
+		// 'i' for indexed (Go 1.11 to 1.19), 'u' for unified (Go 1.20
+		// and later); the binary format (up to Go 1.10) has no such byte.
+		switch {
+		case len(data) > 0 && data[0] == 'i':
+			_, pkg, err = IImportData(fset, packages, data[1:], id)
+		case len(data) > 0 && data[0] == 'u':
+			// The unified format is not self-delimiting, so it must
+			// end exactly at the end-of-section marker.
+			const marker = "\n$$\n"
+			if size < 0 || !bytes.HasSuffix(data, []byte(marker)) {
+				err = fmt.Errorf("import %q: cannot find end of unified export data", path)
+				return
+			}
+			_, pkg, err = UImportData(fset, packages, data[1:len(data)-len(marker)], id)
+		default:
+			_, pkg, err = BImportData(fset, packages, data, id)
+		}
 	default:
 		err = fmt.Errorf("unknown export data header: %q", hdr)
 	}
@@ -7,17 +7,15 @@ package gcimporter
 import (
 	"bytes"
 	"fmt"
-	"internal/testenv"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
 	"time"
 
-	"go/types"
+	"github.com/jba/errside/types"
 )
 
 // skipSpecialPlatforms causes the test to be skipped for platforms where
@@ -34,21 +32,31 @@ func skipSpecialPlatforms(t *testing.T) {
 	}
 }
 
-func compile(t *testing.T, dirname, filename string) string {
-	cmd := exec.Command(testenv.GoToolPath(t), "tool", "compile", filename)
-	cmd.Dir = dirname
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		t.Logf("%s", out)
-		t.Fatalf("go tool compile %s failed: %s", filename, err)
+// skipUninstalled causes the test to be skipped if the standard library
+// is not installed in GOROOT/pkg, as is the case since Go 1.20.
+func skipUninstalled(t *testing.T) {
+	if _, err := os.Stat(filepath.Join(runtime.GOROOT(), "pkg", runtime.GOOS+"_"+runtime.GOARCH)); err != nil {
+		t.Skip("no compiled packages installed in GOROOT")
+	}
+}
+
+// needFixture skips the test if the export data file testdata/name.a is
+// missing. The files are checked in, so that the tests do not depend on the
+// installed toolchain. To make them again, compile each package with the
+// path testdata/name, giving the compiler an import configuration that
+// lists the export data of its dependencies (for b.go, testdata/a=a.a):
+//
+//	go tool compile -p testdata/name -D testdata -importcfg name.importcfg -o name.a name.go
+func needFixture(t *testing.T, name string) {
+	t.Helper()
+	if _, err := os.Stat(filepath.Join("testdata", name+".a")); err != nil {
+		t.Skipf("export data fixture missing: %v", err)
 	}
-	// filename should end with ".go"
-	return filepath.Join(dirname, filename[:len(filename)-2]+"o")
 }
 
 func testPath(t *testing.T, path, srcDir string) *types.Package {
 	t0 := time.Now()
-	pkg, err := Import(make(map[string]*types.Package), path, srcDir)
+	pkg, err := Import(make(map[string]*types.Package), path, srcDir, nil)
 	if err != nil {
 		t.Errorf("testPath(%s): %s", path, err)
 		return nil
@@ -89,15 +97,7 @@ func testDir(t *testing.T, dir string, endTime time.Time) (nimports int) {
 }
 
 func TestImportTestdata(t *testing.T) {
-	// This package only handles gc export data.
-	if runtime.Compiler != "gc" {
-		t.Skipf("gc-built packages not available (compiler = %s)", runtime.Compiler)
-		return
-	}
-
-	if outFn := compile(t, "testdata", "exports.go"); outFn != "" {
-		defer os.Remove(outFn)
-	}
+	needFixture(t, "exports")
 
 	if pkg := testPath(t, "./testdata/exports", "."); pkg != nil {
 		// The package's Imports list must include all packages
@@ -144,8 +144,16 @@ func TestVersionHandling(t *testing.T) {
 		pkgpath := "./" + name[:len(name)-2]
 
 		// test that export data can be imported
-		_, err := Import(make(map[string]*types.Package), pkgpath, dir)
+		_, err := Import(make(map[string]*types.Package), pkgpath, dir, nil)
 		if err != nil {
+			// ok to fail if it fails with a newer version error for select files
+			if strings.Contains(err.Error(), "newer version") {
+				switch name {
+				case "test_go1.11_999b.a", "test_go1.11_999i.a":
+					continue
+				}
+				// fall through
+			}
 			t.Errorf("import %q failed: %v", pkgpath, err)
 			continue
 		}
@@ -173,7 +181,7 @@ func TestVersionHandling(t *testing.T) {
 		defer os.Remove(filename)
 
 		// test that importing the corrupted file results in an error
-		_, err = Import(make(map[string]*types.Package), pkgpath, dir)
+		_, err = Import(make(map[string]*types.Package), pkgpath, dir, nil)
 		if err == nil {
 			t.Errorf("import corrupted %q succeeded", pkgpath)
 		} else if msg := err.Error(); !strings.Contains(msg, "version skew") {
@@ -184,6 +192,7 @@ func TestVersionHandling(t *testing.T) {
 
 func TestImportStdLib(t *testing.T) {
 	skipSpecialPlatforms(t)
+	skipUninstalled(t)
 
 	// This package only handles gc export data.
 	if runtime.Compiler != "gc" {
@@ -192,7 +201,7 @@ func TestImportStdLib(t *testing.T) {
 	}
 
 	dt := maxTime
-	if testing.Short() && testenv.Builder() == "" {
+	if testing.Short() && os.Getenv("GO_BUILDER_NAME") == "" {
 		dt = 10 * time.Millisecond
 	}
 	nimports := testDir(t, "", time.Now().Add(dt)) // installed packages
@@ -212,6 +221,7 @@ var importedObjectTests = []struct {
 
 func TestImportedTypes(t *testing.T) {
 	skipSpecialPlatforms(t)
+	skipUninstalled(t)
 
 	// This package only handles gc export data.
 	if runtime.Compiler != "gc" {
@@ -227,7 +237,7 @@ func TestImportedTypes(t *testing.T) {
 		importPath := s[0]
 		objName := s[1]
 
-		pkg, err := Import(make(map[string]*types.Package), importPath, ".")
+		pkg, err := Import(make(map[string]*types.Package), importPath, ".", nil)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -248,6 +258,7 @@ func TestImportedTypes(t *testing.T) {
 
 func TestIssue5815(t *testing.T) {
 	skipSpecialPlatforms(t)
+	skipUninstalled(t)
 
 	// This package only handles gc export data.
 	if runtime.Compiler != "gc" {
@@ -255,7 +266,7 @@ func TestIssue5815(t *testing.T) {
 		return
 	}
 
-	pkg, err := Import(make(map[string]*types.Package), "strings", ".")
+	pkg, err := Import(make(map[string]*types.Package), "strings", ".", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -281,6 +292,7 @@ func TestIssue5815(t *testing.T) {
 // Smoke test to ensure that imported methods get the correct package.
 func TestCorrectMethodPackage(t *testing.T) {
 	skipSpecialPlatforms(t)
+	skipUninstalled(t)
 
 	// This package only handles gc export data.
 	if runtime.Compiler != "gc" {
@@ -289,7 +301,7 @@ func TestCorrectMethodPackage(t *testing.T) {
 	}
 
 	imports := make(map[string]*types.Package)
-	_, err := Import(imports, "net/http", ".")
+	_, err := Import(imports, "net/http", ".", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -304,29 +316,11 @@ func TestCorrectMethodPackage(t *testing.T) {
 }
 
 func TestIssue13566(t *testing.T) {
-	skipSpecialPlatforms(t)
-
-	// This package only handles gc export data.
-	if runtime.Compiler != "gc" {
-		t.Skipf("gc-built packages not available (compiler = %s)", runtime.Compiler)
-		return
-	}
-
-	// On windows, we have to set the -D option for the compiler to avoid having a drive
-	// letter and an illegal ':' in the import path - just skip it (see also issue #3483).
-	if runtime.GOOS == "windows" {
-		t.Skip("avoid dealing with relative paths/drive letters on windows")
-	}
-
-	if f := compile(t, "testdata", "a.go"); f != "" {
-		defer os.Remove(f)
-	}
-	if f := compile(t, "testdata", "b.go"); f != "" {
-		defer os.Remove(f)
-	}
+	needFixture(t, "a")
+	needFixture(t, "b")
 
 	// import must succeed (test for issue at hand)
-	pkg, err := Import(make(map[string]*types.Package), "./testdata/b", ".")
+	pkg, err := Import(make(map[string]*types.Package), "./testdata/b", ".", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -341,6 +335,7 @@ func TestIssue13566(t *testing.T) {
 
 func TestIssue13898(t *testing.T) {
 	skipSpecialPlatforms(t)
+	skipUninstalled(t)
 
 	// This package only handles gc export data.
 	if runtime.Compiler != "gc" {
@@ -350,7 +345,7 @@ func TestIssue13898(t *testing.T) {
 
 	// import go/internal/gcimporter which imports go/types partially
 	imports := make(map[string]*types.Package)
-	_, err := Import(imports, "go/internal/gcimporter", ".")
+	_, err := Import(imports, "go/internal/gcimporter", ".", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -390,23 +385,7 @@ func TestIssue13898(t *testing.T) {
 }
 
 func TestIssue15517(t *testing.T) {
-	skipSpecialPlatforms(t)
-
-	// This package only handles gc export data.
-	if runtime.Compiler != "gc" {
-		t.Skipf("gc-built packages not available (compiler = %s)", runtime.Compiler)
-		return
-	}
-
-	// On windows, we have to set the -D option for the compiler to avoid having a drive
-	// letter and an illegal ':' in the import path - just skip it (see also issue #3483).
-	if runtime.GOOS == "windows" {
-		t.Skip("avoid dealing with relative paths/drive letters on windows")
-	}
-
-	if f := compile(t, "testdata", "p.go"); f != "" {
-		defer os.Remove(f)
-	}
+	needFixture(t, "p")
 
 	// Multiple imports of p must succeed without redeclaration errors.
 	// We use an import path that's not cleaned up so that the eventual
@@ -422,33 +401,49 @@ func TestIssue15517(t *testing.T) {
 	// The same issue occurs with vendoring.)
 	imports := make(map[string]*types.Package)
 	for i := 0; i < 3; i++ {
-		if _, err := Import(imports, "./././testdata/p", "."); err != nil {
+		if _, err := Import(imports, "./././testdata/p", ".", nil); err != nil {
 			t.Fatal(err)
 		}
 	}
 }
 
 func TestIssue15920(t *testing.T) {
-	skipSpecialPlatforms(t)
+	needFixture(t, "issue15920")
 
-	// This package only handles gc export data.
-	if runtime.Compiler != "gc" {
-		t.Skipf("gc-built packages not available (compiler = %s)", runtime.Compiler)
-		return
-	}
-
-	// On windows, we have to set the -D option for the compiler to avoid having a drive
-	// letter and an illegal ':' in the import path - just skip it (see also issue #3483).
-	if runtime.GOOS == "windows" {
-		t.Skip("avoid dealing with relative paths/drive letters on windows")
+	imports := make(map[string]*types.Package)
+	if _, err := Import(imports, "./testdata/issue15920", ".", nil); err != nil {
+		t.Fatal(err)
 	}
+}
 
-	if f := compile(t, "testdata", "issue15920.go"); f != "" {
-		defer os.Remove(f)
+func TestImportGenerics(t *testing.T) {
+	// generics.a is checked in, so that the test does not
+	// depend on the installed compiler.
+	pkg, err := Import(make(map[string]*types.Package), "./testdata/generics", ".", nil)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	imports := make(map[string]*types.Package)
-	if _, err := Import(imports, "./testdata/issue15920", "."); err != nil {
-		t.Fatal(err)
+	for _, test := range []struct {
+		name string
+		want string
+	}{
+		{"Any", "type Any interface{}"},
+		{"T", "type T[A, B any] struct{Left A; Right B}"},
+		{"X", "var X T[int, string]"},
+		{"ToInt", "func ToInt[P interface{~int}](p P) int"},
+		{"G", "type G[C comparable] int"},
+		{"ImplicitFunc", "func ImplicitFunc[T ~int]()"},
+		{"ImplicitType", "type ImplicitType[T ~int] int"},
+	} {
+		obj := pkg.Scope().Lookup(test.name)
+		if obj == nil {
+			t.Errorf("%s: object not found", test.name)
+			continue
+		}
+		got := types.ObjectString(obj, types.RelativeTo(pkg))
+		if got != test.want {
+			t.Errorf("%s: got %q; want %q", test.name, got, test.want)
+		}
 	}
 }
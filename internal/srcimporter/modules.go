@@ -0,0 +1,333 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the resolution of import paths through
+// go.mod and go.sum files, vendor directories and the module cache.
+
+package srcimporter
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A module describes a module whose go.mod file has been read.
+type module struct {
+	path    string                 // module path
+	dir     string                 // module root directory
+	require map[string]string      // module path -> required version
+	replace map[string]replacement // module path or "path@version" -> replacement
+	sums    map[string][]string    // module path -> versions listed in go.sum
+	vendor  bool                   // whether packages are loaded from the vendor directory
+	inCache bool                   // whether the module lives in the module cache
+}
+
+// A replacement is the right-hand side of a replace directive.
+// If version is empty, path is a directory.
+type replacement struct {
+	path, version string
+}
+
+// modulesFor returns the modules through which imports from srcDir are
+// resolved, in order of preference: the main module, whose go.mod
+// determines the versions of all dependencies, and then the module
+// containing srcDir, if that is another. The main module of a package that
+// was itself imported is the main module through which it was found; that
+// of any other package is the module containing it.
+func (p *Importer) modulesFor(srcDir string) []*module {
+	m := p.findModule(srcDir)
+	main, ok := p.mainFor[srcDir]
+	if !ok {
+		main = m
+	}
+	var mods []*module
+	if main != nil {
+		mods = append(mods, main)
+	}
+	if m != nil && m != main {
+		mods = append(mods, m)
+	}
+	return mods
+}
+
+// findModule returns the module containing dir, or nil.
+func (p *Importer) findModule(dir string) *module {
+	var visited []string
+	var m *module
+	for {
+		if cached, ok := p.modules[dir]; ok {
+			m = cached
+			break
+		}
+		visited = append(visited, dir)
+		if data, err := p.readFile(p.joinPath(dir, "go.mod")); err == nil {
+			m = p.readModule(dir, data)
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	for _, d := range visited {
+		p.modules[d] = m
+	}
+	return m
+}
+
+// readModule returns the module rooted at dir with the given go.mod contents.
+func (p *Importer) readModule(dir string, data []byte) *module {
+	cache := p.modCache()
+	m := &module{
+		dir:     dir,
+		require: make(map[string]string),
+		replace: make(map[string]replacement),
+		sums:    make(map[string][]string),
+		inCache: cache != "" && hasDirPrefix(dir, cache),
+	}
+	block := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		f := fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if block != "" {
+			if f[0] == ")" {
+				block = ""
+				continue
+			}
+			f = append([]string{block}, f...)
+		} else if len(f) == 2 && f[1] == "(" {
+			block = f[0]
+			continue
+		}
+		switch f[0] {
+		case "module":
+			if len(f) == 2 {
+				m.path = f[1]
+			}
+		case "require":
+			if len(f) == 3 {
+				m.require[f[1]] = f[2]
+			}
+		case "replace":
+			// replace old [v] => new [v]
+			i := 0
+			for i < len(f) && f[i] != "=>" {
+				i++
+			}
+			if i == len(f) {
+				continue
+			}
+			from, to := f[1:i], f[i+1:]
+			if len(from) == 0 || len(from) > 2 || len(to) == 0 || len(to) > 2 {
+				continue
+			}
+			key := from[0]
+			if len(from) == 2 {
+				key += "@" + from[1]
+			}
+			r := replacement{path: to[0]}
+			if len(to) == 2 {
+				r.version = to[1]
+			} else if !filepath.IsAbs(r.path) {
+				r.path = p.joinPath(dir, r.path)
+			}
+			m.replace[key] = r
+		}
+	}
+
+	if sum, err := p.readFile(p.joinPath(dir, "go.sum")); err == nil {
+		s := bufio.NewScanner(bytes.NewReader(sum))
+		for s.Scan() {
+			f := strings.Fields(s.Text())
+			if len(f) == 3 && !strings.HasSuffix(f[1], "/go.mod") {
+				m.sums[f[0]] = append(m.sums[f[0]], f[1])
+			}
+		}
+	}
+
+	if !m.inCache && p.isFile(p.joinPath(dir, "vendor", "modules.txt")) {
+		m.vendor = !strings.Contains(os.Getenv("GOFLAGS"), "-mod=mod")
+	}
+	return m
+}
+
+// fields splits a go.mod line into fields, unquoting quoted strings.
+func fields(line string) []string {
+	f := strings.Fields(line)
+	for i, s := range f {
+		if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "`") {
+			if u, err := strconv.Unquote(s); err == nil {
+				f[i] = u
+			}
+		}
+	}
+	return f
+}
+
+// findInModule returns the directory of the package with the given import
+// path as seen from module m, or the empty string.
+func (p *Importer) findInModule(m *module, path string) string {
+	if m.vendor {
+		if dir := p.joinPath(m.dir, "vendor", path); p.isDir(dir) {
+			return dir
+		}
+	}
+	if m.path != "" && hasPathPrefix(path, m.path) {
+		if dir := p.joinPath(m.dir, strings.TrimPrefix(path, m.path)); p.isDir(dir) {
+			return dir
+		}
+	}
+
+	// Find the required module with the longest matching path.
+	// Modules listed only in go.sum serve as a fallback.
+	modPath, version := "", ""
+	for mp, v := range m.require {
+		if hasPathPrefix(path, mp) && len(mp) > len(modPath) {
+			modPath, version = mp, v
+		}
+	}
+	if modPath == "" {
+		for mp, vs := range m.sums {
+			if hasPathPrefix(path, mp) && len(mp) > len(modPath) {
+				modPath, version = mp, maxVersion(vs)
+			}
+		}
+	}
+	if modPath == "" {
+		return ""
+	}
+	rel := strings.TrimPrefix(path, modPath)
+
+	root := ""
+	r, ok := m.replace[modPath+"@"+version]
+	if !ok {
+		r, ok = m.replace[modPath]
+	}
+	switch {
+	case ok && r.version == "":
+		root = r.path
+	case ok:
+		root = p.modCacheDir(r.path, r.version)
+	default:
+		root = p.modCacheDir(modPath, version)
+	}
+	if root == "" {
+		return ""
+	}
+	if dir := p.joinPath(root, rel); p.isDir(dir) {
+		return dir
+	}
+	return ""
+}
+
+// modCache returns the module cache directory.
+func (p *Importer) modCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	if list := filepath.SplitList(p.ctxt.GOPATH); len(list) > 0 && list[0] != "" {
+		return p.joinPath(list[0], "pkg", "mod")
+	}
+	return ""
+}
+
+// modCacheDir returns the directory holding the given module version
+// in the module cache, or the empty string.
+func (p *Importer) modCacheDir(path, version string) string {
+	cache := p.modCache()
+	if cache == "" {
+		return ""
+	}
+	return p.joinPath(cache, escapePath(path)+"@"+escapePath(version))
+}
+
+// escapePath escapes upper-case letters the way the module cache does:
+// "!" followed by the lower-case letter.
+func escapePath(path string) string {
+	var buf bytes.Buffer
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			buf.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// hasPathPrefix reports whether the import path has the given module path as prefix.
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// maxVersion returns the highest semantic version in list.
+func maxVersion(list []string) string {
+	max := ""
+	for _, v := range list {
+		if max == "" || compareVersions(v, max) > 0 {
+			max = v
+		}
+	}
+	return max
+}
+
+// compareVersions compares two semantic versions of the form
+// vMAJOR.MINOR.PATCH[-PRERELEASE][+BUILD], returning -1, 0 or +1.
+func compareVersions(v, w string) int {
+	vnum, vpre := splitVersion(v)
+	wnum, wpre := splitVersion(w)
+	for i := 0; i < 3; i++ {
+		if c := compareInts(vnum[i], wnum[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case vpre == wpre:
+		return 0
+	case vpre == "":
+		return +1
+	case wpre == "":
+		return -1
+	case vpre < wpre:
+		return -1
+	}
+	return +1
+}
+
+// splitVersion returns the numeric components and the prerelease suffix of v.
+func splitVersion(v string) (num [3]string, pre string) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.Index(v, "-"); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+	copy(num[:], strings.SplitN(v, ".", 3))
+	return num, pre
+}
+
+// compareInts compares two non-negative decimal integers given as strings.
+func compareInts(x, y string) int {
+	x = strings.TrimLeft(x, "0")
+	y = strings.TrimLeft(y, "0")
+	switch {
+	case len(x) < len(y) || len(x) == len(y) && x < y:
+		return -1
+	case x == y:
+		return 0
+	}
+	return +1
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package srcimporter
+
+import (
+	"go/build"
+	"go/token"
+	"path/filepath"
+	"testing"
+
+	"github.com/jba/errside/internal/testfiles"
+	"github.com/jba/errside/types"
+)
+
+// The versions of all dependencies are those of the main module, even for
+// imports from a dependency in the module cache that is reached through a
+// replaced module outside of it, whatever the order of imports.
+func TestMainModule(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "cache")
+	t.Setenv("GOMODCACHE", cache)
+	testfiles.Write(t, dir, map[string]string{
+		"a/go.mod": `module example.com/a
+
+require (
+	example.com/d v1.0.0
+	example.com/e v1.2.0
+	example.com/r v0.0.0
+)
+
+replace example.com/r => ../r
+`,
+		"a/a.go":   "package a\nimport \"example.com/r\"\nconst A = r.R\n",
+		"r/go.mod": "module example.com/r\nrequire (\n\texample.com/d v1.0.0\n\texample.com/e v1.0.0\n)\n",
+		"r/r.go":   "package r\nimport \"example.com/d\"\nconst R = d.D\n",
+
+		"cache/example.com/d@v1.0.0/go.mod": "module example.com/d\nrequire example.com/e v1.0.0\n",
+		"cache/example.com/d@v1.0.0/d.go":   "package d\nimport \"example.com/e\"\nconst D = e.E\n",
+		"cache/example.com/e@v1.0.0/go.mod": "module example.com/e\n",
+		"cache/example.com/e@v1.0.0/e.go":   "package e\nconst E = 1\n",
+		"cache/example.com/e@v1.2.0/go.mod": "module example.com/e\n",
+		"cache/example.com/e@v1.2.0/e.go":   "package e\nconst E = 2\n",
+	})
+	if got := constA(t, dir); got != "2" {
+		t.Errorf("A = %s, want 2, from example.com/e v1.2.0", got)
+	}
+}
+
+// constA imports example.com/a from dir/a and returns the value of its
+// constant A.
+func constA(t *testing.T, dir string) string {
+	t.Helper()
+	ctxt := build.Default
+	ctxt.GOPATH = ""
+	p := New(&ctxt, token.NewFileSet(), make(map[string]*types.Package))
+	pkg, err := p.ImportFrom("example.com/a", filepath.Join(dir, "a"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := pkg.Scope().Lookup("A").(*types.Const)
+	if !ok {
+		t.Fatal("no constant A")
+	}
+	return c.Val().String()
+}
+
+// A module with a vendor directory imports its dependencies from there,
+// unless GOFLAGS holds -mod=mod.
+func TestVendor(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOMODCACHE", filepath.Join(dir, "cache"))
+	testfiles.Write(t, dir, map[string]string{
+		"a/go.mod":                        "module example.com/a\nrequire example.com/v v1.0.0\n",
+		"a/a.go":                          "package a\nimport \"example.com/v/sub\"\nconst A = sub.V\n",
+		"a/vendor/modules.txt":            "# example.com/v v1.0.0\n## explicit\nexample.com/v/sub\n",
+		"a/vendor/example.com/v/sub/v.go": "package sub\nconst V = 1\n",
+
+		"cache/example.com/v@v1.0.0/go.mod":   "module example.com/v\n",
+		"cache/example.com/v@v1.0.0/sub/v.go": "package sub\nconst V = 2\n",
+	})
+	for _, test := range []struct {
+		goflags, want string
+	}{
+		{"", "1"},
+		{"-mod=vendor", "1"},
+		{"-mod=mod", "2"},
+	} {
+		t.Setenv("GOFLAGS", test.goflags)
+		if got := constA(t, dir); got != test.want {
+			t.Errorf("GOFLAGS=%q: A = %s, want %s", test.goflags, got, test.want)
+		}
+	}
+}
+
+// A module that is not required but listed in go.sum is found in the
+// module cache, at the highest version listed. Upper-case letters in its
+// path are escaped there.
+func TestGoSum(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOMODCACHE", filepath.Join(dir, "cache"))
+	testfiles.Write(t, dir, map[string]string{
+		"a/go.mod": "module example.com/a\n",
+		"a/a.go":   "package a\nimport \"example.com/Sum\"\nconst A = sum.S\n",
+		"a/go.sum": `example.com/Sum v1.0.0 h1:AAAA=
+example.com/Sum v1.0.0/go.mod h1:BBBB=
+example.com/Sum v1.10.0 h1:CCCC=
+example.com/Sum v1.10.0/go.mod h1:DDDD=
+example.com/Sum v1.9.0 h1:EEEE=
+example.com/Sum v2.0.0/go.mod h1:FFFF=
+`,
+		"cache/example.com/!sum@v1.0.0/s.go":  "package sum\nconst S = 1\n",
+		"cache/example.com/!sum@v1.9.0/s.go":  "package sum\nconst S = 9\n",
+		"cache/example.com/!sum@v1.10.0/s.go": "package sum\nconst S = 10\n",
+	})
+	if got := constA(t, dir); got != "10" {
+		t.Errorf("A = %s, want 10, from example.com/Sum v1.10.0", got)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package srcimporter implements importing directly
+// from source files rather than installed packages.
+package srcimporter
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/parser"
+	"github.com/jba/errside/types"
+)
+
+// An Importer provides the context for importing packages from source code.
+type Importer struct {
+	ctxt     *build.Context
+	fset     *token.FileSet
+	packages map[string]*types.Package
+	modules  map[string]*module // go.mod files read so far, by directory; nil if none
+	mainFor  map[string]*module // package directory -> main module through which it was found
+}
+
+// New returns a new Importer for the given context, file set, and map
+// of packages. The context is used to resolve import paths to package paths,
+// and identifying the files belonging to the package. If the context provides
+// non-nil file system functions, they are used instead of the regular package
+// os functions. The file set is used to track position information of package
+// files; and imported packages are added to the packages map.
+//
+// Import paths are resolved as the go command does: through the go.mod file
+// of the enclosing module (including its replace directives), its vendor
+// directory, the go.sum file and the module cache, and finally GOPATH.
+func New(ctxt *build.Context, fset *token.FileSet, packages map[string]*types.Package) *Importer {
+	return &Importer{
+		ctxt:     ctxt,
+		fset:     fset,
+		packages: packages,
+		modules:  make(map[string]*module),
+		mainFor:  make(map[string]*module),
+	}
+}
+
+// WithPackage returns an Importer that imports pkg for the given import
+// path, as for an external test package, which sees the package under test
+// together with its internal test files. The packages that p has imported
+// are shared, except for those that depend on path: they are imported
+// again, so that they depend on pkg.
+func (p *Importer) WithPackage(path string, pkg *types.Package) *Importer {
+	depends := make(map[*types.Package]bool)
+	var dependsOn func(q *types.Package) bool
+	dependsOn = func(q *types.Package) bool {
+		if d, ok := depends[q]; ok {
+			return d
+		}
+		depends[q] = false // for import cycles
+		for _, imp := range q.Imports() {
+			if imp.Path() == path || dependsOn(imp) {
+				depends[q] = true
+				return true
+			}
+		}
+		return false
+	}
+	packages := make(map[string]*types.Package)
+	for id, q := range p.packages {
+		if q != nil && q != &importing && !dependsOn(q) {
+			packages[id] = q
+		}
+	}
+	packages[path] = pkg
+	return &Importer{
+		ctxt:     p.ctxt,
+		fset:     p.fset,
+		packages: packages,
+		modules:  p.modules,
+		mainFor:  p.mainFor,
+	}
+}
+
+// Importing is a sentinel taking the place in Importer.packages
+// for a package that is in the process of being imported.
+var importing types.Package
+
+// Import(path) is a shortcut for ImportFrom(path, "", 0).
+func (p *Importer) Import(path string) (*types.Package, error) {
+	return p.ImportFrom(path, "", 0)
+}
+
+// ImportFrom imports the package with the given import path resolved from the given srcDir,
+// adds the new package to the set of packages maintained by the importer, and returns the
+// package. Package path resolution and file system operations are controlled by the context
+// maintained with the importer. The import mode must be zero but is otherwise ignored.
+// Packages that are not comprised entirely of pure Go files may fail to import because the
+// type checker may not be able to determine all exported entities (e.g. due to cgo dependencies).
+func (p *Importer) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if mode != 0 {
+		panic("non-zero import mode")
+	}
+
+	if abs, err := filepath.Abs(srcDir); err == nil { // see issue #14282
+		srcDir = abs
+	}
+	// TODO(gri) also set the Context's build tags here?
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	dir, id, err := p.findPkg(path, srcDir)
+	if err != nil {
+		return nil, err // err may be *build.NoGoError - return as is
+	}
+
+	// package unsafe is known to the type checker
+	if id == "unsafe" {
+		return types.Unsafe, nil
+	}
+
+	// no need to re-import if the package was imported completely before
+	pkg := p.packages[id]
+	if pkg != nil {
+		if pkg == &importing {
+			return nil, fmt.Errorf("import cycle through package %q", id)
+		}
+		if !pkg.Complete() {
+			// Package exists but is not complete - we cannot handle this
+			// at the moment since the source importer replaces the package
+			// wholesale rather than augmenting it (see #19337 for details).
+			// Return incomplete package with error (see #16088).
+			return pkg, fmt.Errorf("reimported partially imported package %q", id)
+		}
+		return pkg, nil
+	}
+
+	bp, err := p.ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err // err may be *build.NoGoError - return as is
+	}
+
+	p.packages[id] = &importing
+	defer func() {
+		// clean up in case of error
+		// TODO(gri) Eventually we may want to leave a (possibly empty)
+		// package in the map in all cases (and use that package to
+		// identify cycles). See also issue 16088.
+		if p.packages[id] == &importing {
+			p.packages[id] = nil
+		}
+	}()
+
+	var filenames []string
+	filenames = append(filenames, bp.GoFiles...)
+	filenames = append(filenames, bp.CgoFiles...)
+
+	files, err := p.parseFiles(bp.Dir, filenames)
+	if err != nil {
+		return nil, err
+	}
+
+	// type-check package files
+	var firstHardErr error
+	conf := types.Config{
+		IgnoreFuncBodies: true,
+		FakeImportC:      true,
+		// continue type-checking after the first error
+		Error: func(err error) {
+			if firstHardErr == nil && !err.(types.Error).Soft {
+				firstHardErr = err
+			}
+		},
+		Importer: p,
+	}
+	pkg, err = conf.Check(id, p.fset, files, nil)
+	if err != nil {
+		// If there was a hard error it is possibly unsafe
+		// to use the package as it may not be fully populated.
+		// Do not return it (see also #20837, #20855).
+		if firstHardErr != nil {
+			pkg = nil
+			err = firstHardErr // give preference to first hard error over any soft error
+		}
+		return pkg, fmt.Errorf("type-checking package %q failed (%v)", id, err)
+	}
+
+	p.packages[id] = pkg
+	return pkg, nil
+}
+
+func (p *Importer) parseFiles(dir string, filenames []string) ([]*ast.File, error) {
+	files := make([]*ast.File, len(filenames))
+	for i, filename := range filenames {
+		filepath := p.joinPath(dir, filename)
+		src, err := p.readFile(filepath)
+		if err != nil {
+			return nil, err
+		}
+		files[i], err = parser.ParseFile(p.fset, filepath, src, 0)
+		if err != nil {
+			return nil, err // return first error
+		}
+	}
+	return files, nil
+}
+
+// findPkg returns the directory of the package with the given import path,
+// as seen from srcDir, and the path identifying the package.
+func (p *Importer) findPkg(path, srcDir string) (dir, id string, err error) {
+	if build.IsLocalImport(path) {
+		dir = p.joinPath(srcDir, path)
+		if !p.isDir(dir) {
+			return "", "", fmt.Errorf("cannot find package %q in:\n\t%s", path, dir)
+		}
+		return dir, dir, nil
+	}
+
+	// Standard library, including packages vendored into it.
+	goroot := p.joinPath(p.ctxt.GOROOT, "src")
+	if p.ctxt.GOROOT != "" {
+		if hasDirPrefix(srcDir, goroot) {
+			if dir := p.joinPath(goroot, "vendor", path); p.isDir(dir) {
+				return dir, "vendor/" + path, nil
+			}
+		}
+		if isStandardImportPath(path) {
+			if dir := p.joinPath(goroot, path); p.isDir(dir) {
+				return dir, path, nil
+			}
+		}
+	}
+
+	// Modules.
+	mods := p.modulesFor(srcDir)
+	for _, m := range mods {
+		if dir := p.findInModule(m, path); dir != "" {
+			if _, ok := p.mainFor[dir]; !ok {
+				p.mainFor[dir] = mods[0]
+			}
+			return dir, path, nil
+		}
+	}
+
+	// GOPATH.
+	for _, root := range p.ctxt.SrcDirs() {
+		if root == goroot {
+			continue
+		}
+		if dir := p.joinPath(root, path); p.isDir(dir) {
+			return dir, path, nil
+		}
+	}
+	return "", "", fmt.Errorf("cannot find package %q (from %s)", path, srcDir)
+}
+
+// isStandardImportPath reports whether path is the import path of a
+// package in the standard library: its first element contains no dot.
+func isStandardImportPath(path string) bool {
+	i := strings.Index(path, "/")
+	if i < 0 {
+		i = len(path)
+	}
+	return !strings.Contains(path[:i], ".")
+}
+
+// hasDirPrefix reports whether dir is root or a directory below it.
+func hasDirPrefix(dir, root string) bool {
+	return dir == root || strings.HasPrefix(dir, root+string(filepath.Separator))
+}
+
+// context-controlled file system operations
+
+func (p *Importer) isDir(path string) bool {
+	if f := p.ctxt.IsDir; f != nil {
+		return f(path)
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+func (p *Importer) isFile(path string) bool {
+	if p.ctxt.OpenFile != nil {
+		r, err := p.ctxt.OpenFile(path)
+		if err != nil {
+			return false
+		}
+		r.Close()
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+func (p *Importer) joinPath(elem ...string) string {
+	if f := p.ctxt.JoinPath; f != nil {
+		return f(elem...)
+	}
+	return filepath.Join(elem...)
+}
+
+func (p *Importer) readFile(path string) ([]byte, error) {
+	if f := p.ctxt.OpenFile; f != nil {
+		r, err := f(path)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return ioutil.ReadFile(path)
+}
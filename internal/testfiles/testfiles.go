@@ -0,0 +1,23 @@
+// Package testfiles writes trees of files for tests.
+package testfiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write writes files, a map from slash-separated paths to contents, under
+// dir, creating directories as needed.
+func Write(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
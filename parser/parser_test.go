@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"go/token"
+	"reflect"
+	"testing"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/errstmt"
+)
+
+// funcBody parses the statements in body as the body of a function, in
+// SideNotes mode, and returns them.
+func funcBody(t *testing.T, body string) []ast.Stmt {
+	t.Helper()
+	src := "package p\nfunc f() {\n" + body + "\n}\n"
+	file, err := ParseFile(token.NewFileSet(), "", src, SideNotes)
+	if err != nil {
+		t.Fatalf("%q: %v", body, err)
+	}
+	return file.Decls[0].(*ast.FuncDecl).Body.List
+}
+
+func stmtTypes(list []ast.Stmt) []string {
+	var types []string
+	for _, s := range list {
+		types = append(types, reflect.TypeOf(s).String())
+	}
+	return types
+}
+
+// Side-note text that is also valid Go must keep its meaning as Go.
+func TestPlainGoInSideNotesMode(t *testing.T) {
+	for _, test := range []struct {
+		body string
+		want []string
+	}{
+		{"v = err; if err != nil { return }", []string{"*ast.AssignStmt", "*ast.IfStmt"}},
+		{"v.f = err; if err != nil { return }", []string{"*ast.AssignStmt", "*ast.IfStmt"}},
+		{"(v) = err; if err != nil { return }", []string{"*ast.AssignStmt", "*ast.IfStmt"}},
+		{"a, b = c, err; if err != nil { return }", []string{"*ast.AssignStmt", "*ast.IfStmt"}},
+		{"v := err; if err != nil { return }", []string{"*ast.AssignStmt", "*ast.IfStmt"}},
+		{"v = err\nif err != nil { return }", []string{"*ast.AssignStmt", "*ast.IfStmt"}},
+		{"x = y == z; if x { return }", []string{"*ast.AssignStmt", "*ast.IfStmt"}},
+	} {
+		if got := stmtTypes(funcBody(t, test.body)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.body, got, test.want)
+		}
+	}
+}
+
+// Text that is not valid Go is read as a side note.
+func TestSideNotes(t *testing.T) {
+	for _, test := range []struct {
+		body    string
+		first   string // the type of the first statement of the side note
+		isShort bool
+		isInit  bool
+	}{
+		{body: "f() = err; if err != nil { return }", first: "*ast.ExprStmt"},
+		{body: "(f()) = err; if err != nil { return }", first: "*ast.ExprStmt"},
+		{body: "<-c = err; if err != nil { return }", first: "*ast.ExprStmt"},
+		{body: "v := f() =: err; if err != nil { return }", first: "*ast.AssignStmt", isShort: true},
+		{body: "v = w = ok; if !ok { return }", first: "*ast.AssignStmt"},
+		{body: "f() =: err if err != nil { return }", first: "*ast.ExprStmt", isShort: true, isInit: true},
+		{body: "v, w := f()\n=: err; if err != nil { return }", first: "*ast.AssignStmt", isShort: true},
+	} {
+		list := funcBody(t, test.body)
+		if len(list) != 1 {
+			t.Errorf("%q: got %v, want one side note", test.body, stmtTypes(list))
+			continue
+		}
+		s, ok := list[0].(*errstmt.AssignIfErrStmt)
+		if !ok {
+			t.Errorf("%q: got %T, want a side note", test.body, list[0])
+			continue
+		}
+		if got := reflect.TypeOf(s.FirstStmt).String(); got != test.first {
+			t.Errorf("%q: first statement is %s, want %s", test.body, got, test.first)
+		}
+		if s.IsShort != test.isShort || s.IsInit != test.isInit {
+			t.Errorf("%q: IsShort, IsInit = %t, %t; want %t, %t", test.body, s.IsShort, s.IsInit, test.isShort, test.isInit)
+		}
+	}
+}
@@ -10,16 +10,14 @@ package printer
 
 import (
 	"bytes"
-	"fmt"
-
-	"github.com/jba/errside/ast"
-	"github.com/jba/errside/errstmt"
-
 	"go/token"
 	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/errstmt"
 )
 
 // Formatting issues:
@@ -35,32 +33,31 @@ import (
 
 // Print as many newlines as necessary (but at least min newlines) to get to
 // the current line. ws is printed before the first line break. If newSection
-// is set, the first line break is printed as formfeed. Returns true if any
-// line break was printed; returns false otherwise.
+// is set, the first line break is printed as formfeed. Returns 0 if no line
+// breaks were printed, returns 1 if there was exactly one newline printed,
+// and returns a value > 1 if there was a formfeed or more than one newline
+// printed.
 //
 // TODO(gri): linebreak may add too many lines if the next statement at "line"
-//            is preceded by comments because the computation of n assumes
-//            the current position before the comment and the target position
-//            after the comment. Thus, after interspersing such comments, the
-//            space taken up by them is not considered to reduce the number of
-//            linebreaks. At the moment there is no easy way to know about
-//            future (not yet interspersed) comments in this function.
-//
-func (p *printer) linebreak(line, min int, ws whiteSpace, newSection bool) (printedBreak bool) {
-	n := nlimit(line - p.pos.Line)
-	if n < min {
-		n = min
-	}
+// is preceded by comments because the computation of n assumes
+// the current position before the comment and the target position
+// after the comment. Thus, after interspersing such comments, the
+// space taken up by them is not considered to reduce the number of
+// linebreaks. At the moment there is no easy way to know about
+// future (not yet interspersed) comments in this function.
+func (p *printer) linebreak(line, min int, ws whiteSpace, newSection bool) (nbreaks int) {
+	n := max(nlimit(line-p.pos.Line), min)
 	if n > 0 {
 		p.print(ws)
 		if newSection {
 			p.print(formfeed)
 			n--
+			nbreaks = 2
 		}
+		nbreaks += n
 		for ; n > 0; n-- {
 			p.print(newline)
 		}
-		printedBreak = true
 	}
 	return
 }
@@ -115,18 +112,31 @@ func (p *printer) identList(list []*ast.Ident, indent bool) {
 	if !indent {
 		mode = noIndent
 	}
-	p.exprList(token.NoPos, xlist, 1, mode, token.NoPos)
+	p.exprList(token.NoPos, xlist, 1, mode, token.NoPos, false)
 }
 
+const filteredMsg = "contains filtered or unexported fields"
+
 // Print a list of expressions. If the list spans multiple
 // source lines, the original line breaks are respected between
 // expressions.
 //
 // TODO(gri) Consider rewriting this to be independent of []ast.Expr
-//           so that we can use the algorithm for any kind of list
-//           (e.g., pass list via a channel over which to range).
-func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exprListMode, next0 token.Pos) {
+// so that we can use the algorithm for any kind of list
+//
+//	(e.g., pass list via a channel over which to range).
+func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exprListMode, next0 token.Pos, isIncomplete bool) {
 	if len(list) == 0 {
+		if isIncomplete {
+			prev := p.posFor(prev0)
+			next := p.posFor(next0)
+			if prev.IsValid() && prev.Line == next.Line {
+				p.print("/* " + filteredMsg + " */")
+			} else {
+				p.print(newline)
+				p.print(indent, "// "+filteredMsg, unindent, newline)
+			}
+		}
 		return
 	}
 
@@ -141,27 +151,31 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 			if i > 0 {
 				// use position of expression following the comma as
 				// comma position for correct comment placement
-				p.print(x.Pos(), token.COMMA, blank)
+				p.setPos(x.Pos())
+				p.print(token.COMMA, blank)
 			}
 			p.expr0(x, depth)
 		}
+		if isIncomplete {
+			p.print(token.COMMA, blank, "/* "+filteredMsg+" */")
+		}
 		return
 	}
 
 	// list entries span multiple lines;
 	// use source code positions to guide line breaks
 
-	// don't add extra indentation if noIndent is set;
-	// i.e., pretend that the first line is already indented
+	// Don't add extra indentation if noIndent is set;
+	// i.e., pretend that the first line is already indented.
 	ws := ignore
 	if mode&noIndent == 0 {
 		ws = indent
 	}
 
-	// the first linebreak is always a formfeed since this section must not
-	// depend on any previous formatting
+	// The first linebreak is always a formfeed since this section must not
+	// depend on any previous formatting.
 	prevBreak := -1 // index of last expression that was followed by a linebreak
-	if prev.IsValid() && prev.Line < line && p.linebreak(line, 0, ws, true) {
+	if prev.IsValid() && prev.Line < line && p.linebreak(line, 0, ws, true) > 0 {
 		ws = ignore
 		prevBreak = 0
 	}
@@ -169,22 +183,29 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 	// initialize expression/key size: a zero value indicates expr/key doesn't fit on a single line
 	size := 0
 
+	// We use the ratio between the geometric mean of the previous key sizes and
+	// the current size to determine if there should be a break in the alignment.
+	// To compute the geometric mean we accumulate the log₂(size) values (log2sum)
+	// and the number of sizes included (count).
+	log2sum := 0.0
+	count := 0
+
 	// print all list elements
 	prevLine := prev.Line
 	for i, x := range list {
 		line = p.lineFor(x.Pos())
 
-		// determine if the next linebreak, if any, needs to use formfeed:
+		// Determine if the next linebreak, if any, needs to use formfeed:
 		// in general, use the entire node size to make the decision; for
-		// key:value expressions, use the key size
+		// key:value expressions, use the key size.
 		// TODO(gri) for a better result, should probably incorporate both
 		//           the key and the node size into the decision process
 		useFF := true
 
-		// determine element size: all bets are off if we don't have
+		// Determine element size: All bets are off if we don't have
 		// position information for the previous and next token (likely
 		// generated code - simply ignore the size in this case by setting
-		// it to 0)
+		// it to 0).
 		prevSize := size
 		const infinity = 1e6 // larger than any source line
 		size = p.nodeSize(x, infinity)
@@ -199,40 +220,51 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 			size = 0
 		}
 
-		// if the previous line and the current line had single-
+		// If the previous line and the current line had single-
 		// line-expressions and the key sizes are small or the
-		// the ratio between the key sizes does not exceed a
-		// threshold, align columns and do not use formfeed
+		// ratio between the current key and the geometric mean
+		// if the previous key sizes does not exceed a threshold,
+		// align columns and do not use formfeed.
 		if prevSize > 0 && size > 0 {
-			const smallSize = 20
-			if prevSize <= smallSize && size <= smallSize {
+			const smallSize = 40
+			if count == 0 || prevSize <= smallSize && size <= smallSize {
 				useFF = false
 			} else {
-				const r = 4 // threshold
-				ratio := float64(size) / float64(prevSize)
-				useFF = ratio <= 1.0/r || r <= ratio
+				const r = 2.5                                // threshold
+				geomean := exp2ish(log2sum / float64(count)) // count > 0
+				ratio := float64(size) / geomean
+				useFF = r*ratio <= 1 || r <= ratio
 			}
 		}
 
 		needsLinebreak := 0 < prevLine && prevLine < line
 		if i > 0 {
-			// use position of expression following the comma as
+			// Use position of expression following the comma as
 			// comma position for correct comment placement, but
-			// only if the expression is on the same line
+			// only if the expression is on the same line.
 			if !needsLinebreak {
-				p.print(x.Pos())
+				p.setPos(x.Pos())
 			}
 			p.print(token.COMMA)
 			needsBlank := true
 			if needsLinebreak {
-				// lines are broken using newlines so comments remain aligned
-				// unless forceFF is set or there are multiple expressions on
-				// the same line in which case formfeed is used
-				if p.linebreak(line, 0, ws, useFF || prevBreak+1 < i) {
+				// Lines are broken using newlines so comments remain aligned
+				// unless useFF is set or there are multiple expressions on
+				// the same line in which case formfeed is used.
+				nbreaks := p.linebreak(line, 0, ws, useFF || prevBreak+1 < i)
+				if nbreaks > 0 {
 					ws = ignore
 					prevBreak = i
 					needsBlank = false // we got a line break instead
 				}
+				// If there was a new section or more than one new line
+				// (which means that the tabwriter will implicitly break
+				// the section), reset the geomean variables since we are
+				// starting a new group of elements with the next element.
+				if nbreaks > 1 {
+					log2sum = 0
+					count = 0
+				}
 			}
 			if needsBlank {
 				p.print(blank)
@@ -240,24 +272,34 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 		}
 
 		if len(list) > 1 && isPair && size > 0 && needsLinebreak {
-			// we have a key:value expression that fits onto one line
+			// We have a key:value expression that fits onto one line
 			// and it's not on the same line as the prior expression:
-			// use a column for the key such that consecutive entries
-			// can align if possible
+			// Use a column for the key such that consecutive entries
+			// can align if possible.
 			// (needsLinebreak is set if we started a new line before)
 			p.expr(pair.Key)
-			p.print(pair.Colon, token.COLON, vtab)
+			p.setPos(pair.Colon)
+			p.print(token.COLON, vtab)
 			p.expr(pair.Value)
 		} else {
 			p.expr0(x, depth)
 		}
 
+		if size > 0 {
+			log2sum += log2ish(float64(size))
+			count++
+		}
+
 		prevLine = line
 	}
 
 	if mode&commaTerm != 0 && next.IsValid() && p.pos.Line < next.Line {
-		// print a terminating comma if the next token is on a new line
+		// Print a terminating comma if the next token is on a new line.
 		p.print(token.COMMA)
+		if isIncomplete {
+			p.print(newline)
+			p.print("// " + filteredMsg)
+		}
 		if ws == ignore && mode&noIndent == 0 {
 			// unindent if we indented
 			p.print(unindent)
@@ -266,14 +308,32 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 		return
 	}
 
+	if isIncomplete {
+		p.print(token.COMMA, newline)
+		p.print("// "+filteredMsg, newline)
+	}
+
 	if ws == ignore && mode&noIndent == 0 {
 		// unindent if we indented
 		p.print(unindent)
 	}
 }
 
-func (p *printer) parameters(fields *ast.FieldList) {
-	p.print(fields.Opening, token.LPAREN)
+type paramMode int
+
+const (
+	funcParam paramMode = iota
+	funcTParam
+	typeTParam
+)
+
+func (p *printer) parameters(fields *ast.FieldList, mode paramMode) {
+	openTok, closeTok := token.LPAREN, token.RPAREN
+	if mode != funcParam {
+		openTok, closeTok = token.LBRACK, token.RBRACK
+	}
+	p.setPos(fields.Opening)
+	p.print(openTok)
 	if len(fields.List) > 0 {
 		prevLine := p.lineFor(fields.Opening)
 		ws := indent
@@ -281,13 +341,8 @@ func (p *printer) parameters(fields *ast.FieldList) {
 			// determine par begin and end line (may be different
 			// if there are multiple parameter names for this par
 			// or the type is on a separate line)
-			var parLineBeg int
-			if len(par.Names) > 0 {
-				parLineBeg = p.lineFor(par.Names[0].Pos())
-			} else {
-				parLineBeg = p.lineFor(par.Type.Pos())
-			}
-			var parLineEnd = p.lineFor(par.Type.End())
+			parLineBeg := p.lineFor(par.Pos())
+			parLineEnd := p.lineFor(par.End())
 			// separating "," if needed
 			needsLinebreak := 0 < prevLine && prevLine < parLineBeg
 			if i > 0 {
@@ -295,12 +350,12 @@ func (p *printer) parameters(fields *ast.FieldList) {
 				// comma position for correct comma placement, but
 				// only if the next parameter is on the same line
 				if !needsLinebreak {
-					p.print(par.Pos())
+					p.setPos(par.Pos())
 				}
 				p.print(token.COMMA)
 			}
 			// separator if needed (linebreak or blank)
-			if needsLinebreak && p.linebreak(parLineBeg, 0, ws, true) {
+			if needsLinebreak && p.linebreak(parLineBeg, 0, ws, true) > 0 {
 				// break line if the opening "(" or previous parameter ended on a different line
 				ws = ignore
 			} else if i > 0 {
@@ -321,36 +376,84 @@ func (p *printer) parameters(fields *ast.FieldList) {
 			p.expr(stripParensAlways(par.Type))
 			prevLine = parLineEnd
 		}
+
 		// if the closing ")" is on a separate line from the last parameter,
 		// print an additional "," and line break
 		if closing := p.lineFor(fields.Closing); 0 < prevLine && prevLine < closing {
 			p.print(token.COMMA)
 			p.linebreak(closing, 0, ignore, true)
+		} else if mode == typeTParam && fields.NumFields() == 1 && combinesWithName(stripParensAlways(fields.List[0].Type)) {
+			// A type parameter list [P T] where the name P and the type expression T syntactically
+			// combine to another valid (value) expression requires a trailing comma, as in [P *T,]
+			// (or an enclosing interface as in [P interface(*T)]), so that the type parameter list
+			// is not parsed as an array length [P*T].
+			p.print(token.COMMA)
 		}
+
 		// unindent if we indented
 		if ws == ignore {
 			p.print(unindent)
 		}
 	}
-	p.print(fields.Closing, token.RPAREN)
+
+	p.setPos(fields.Closing)
+	p.print(closeTok)
+}
+
+// combinesWithName reports whether a name followed by the expression x
+// syntactically combines to another valid (value) expression. For instance
+// using *T for x, "name *T" syntactically appears as the expression x*T.
+// On the other hand, using  P|Q or *P|~Q for x, "name P|Q" or "name *P|~Q"
+// cannot be combined into a valid (value) expression.
+func combinesWithName(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.StarExpr:
+		// name *x.X combines to name*x.X if x.X is not a type element
+		return !isTypeElem(x.X)
+	case *ast.BinaryExpr:
+		return combinesWithName(x.X) && !isTypeElem(x.Y)
+	case *ast.ParenExpr:
+		return !isTypeElem(x.X)
+	}
+	return false
+}
+
+// isTypeElem reports whether x is a (possibly parenthesized) type element expression.
+// The result is false if x could be a type element OR an ordinary (value) expression.
+func isTypeElem(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.ArrayType, *ast.StructType, *ast.FuncType, *ast.InterfaceType, *ast.MapType, *ast.ChanType:
+		return true
+	case *ast.UnaryExpr:
+		return x.Op == token.TILDE
+	case *ast.BinaryExpr:
+		return isTypeElem(x.X) || isTypeElem(x.Y)
+	case *ast.ParenExpr:
+		return isTypeElem(x.X)
+	}
+	return false
 }
 
-func (p *printer) signature(params, result *ast.FieldList) {
-	if params != nil {
-		p.parameters(params)
+func (p *printer) signature(sig *ast.FuncType) {
+	if sig.TypeParams != nil {
+		p.parameters(sig.TypeParams, funcTParam)
+	}
+	if sig.Params != nil {
+		p.parameters(sig.Params, funcParam)
 	} else {
 		p.print(token.LPAREN, token.RPAREN)
 	}
-	n := result.NumFields()
+	res := sig.Results
+	n := res.NumFields()
 	if n > 0 {
-		// result != nil
+		// res != nil
 		p.print(blank)
-		if n == 1 && result.List[0].Names == nil {
-			// single anonymous result; no ()'s
-			p.expr(stripParensAlways(result.List[0].Type))
+		if n == 1 && res.List[0].Names == nil {
+			// single anonymous res; no ()'s
+			p.expr(stripParensAlways(res.List[0].Type))
 			return
 		}
-		p.parameters(result)
+		p.parameters(res, funcParam)
 	}
 }
 
@@ -400,31 +503,50 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 		// possibly a one-line struct/interface
 		if len(list) == 0 {
 			// no blank between keyword and {} in this case
-			p.print(lbrace, token.LBRACE, rbrace, token.RBRACE)
+			p.setPos(lbrace)
+			p.print(token.LBRACE)
+			p.setPos(rbrace)
+			p.print(token.RBRACE)
 			return
-		} else if isStruct && p.isOneLineFieldList(list) { // for now ignore interfaces
+		} else if p.isOneLineFieldList(list) {
 			// small enough - print on one line
 			// (don't use identList and ignore source line breaks)
-			p.print(lbrace, token.LBRACE, blank)
+			p.setPos(lbrace)
+			p.print(token.LBRACE, blank)
 			f := list[0]
-			for i, x := range f.Names {
-				if i > 0 {
-					// no comments so no need for comma position
-					p.print(token.COMMA, blank)
+			if isStruct {
+				for i, x := range f.Names {
+					if i > 0 {
+						// no comments so no need for comma position
+						p.print(token.COMMA, blank)
+					}
+					p.expr(x)
+				}
+				if len(f.Names) > 0 {
+					p.print(blank)
+				}
+				p.expr(f.Type)
+			} else { // interface
+				if len(f.Names) > 0 {
+					name := f.Names[0] // method name
+					p.expr(name)
+					p.signature(f.Type.(*ast.FuncType)) // don't print "func"
+				} else {
+					// embedded interface
+					p.expr(f.Type)
 				}
-				p.expr(x)
-			}
-			if len(f.Names) > 0 {
-				p.print(blank)
 			}
-			p.expr(f.Type)
-			p.print(blank, rbrace, token.RBRACE)
+			p.print(blank)
+			p.setPos(rbrace)
+			p.print(token.RBRACE)
 			return
 		}
 	}
 	// hasComments || !srcIsOneLine
 
-	p.print(blank, lbrace, token.LBRACE, indent)
+	p.print(blank)
+	p.setPos(lbrace)
+	p.print(token.LBRACE, indent)
 	if hasComments || len(list) > 0 {
 		p.print(formfeed)
 	}
@@ -474,25 +596,39 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 				p.print(formfeed)
 			}
 			p.flush(p.posFor(rbrace), token.RBRACE) // make sure we don't lose the last line comment
-			p.setLineComment("// contains filtered or unexported fields")
+			p.setLineComment("// " + filteredMsg)
 		}
 
 	} else { // interface
 
 		var line int
+		var prev *ast.Ident // previous "type" identifier
 		for i, f := range list {
+			var name *ast.Ident // first name, or nil
+			if len(f.Names) > 0 {
+				name = f.Names[0]
+			}
 			if i > 0 {
-				p.linebreak(p.lineFor(f.Pos()), 1, ignore, p.linesFrom(line) > 0)
+				// don't do a line break (min == 0) if we are printing a list of types
+				// TODO(gri) this doesn't work quite right if the list of types is
+				//           spread across multiple lines
+				min := 1
+				if prev != nil && name == prev {
+					min = 0
+				}
+				p.linebreak(p.lineFor(f.Pos()), min, ignore, p.linesFrom(line) > 0)
 			}
 			p.setComment(f.Doc)
 			p.recordLine(&line)
-			if ftyp, isFtyp := f.Type.(*ast.FuncType); isFtyp {
+			if name != nil {
 				// method
-				p.expr(f.Names[0])
-				p.signature(ftyp.Params, ftyp.Results)
+				p.expr(name)
+				p.signature(f.Type.(*ast.FuncType)) // don't print "func"
+				prev = nil
 			} else {
 				// embedded interface
 				p.expr(f.Type)
+				prev = nil
 			}
 			p.setComment(f.Comment)
 		}
@@ -505,7 +641,9 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 		}
 
 	}
-	p.print(unindent, formfeed, rbrace, token.RBRACE)
+	p.print(unindent, formfeed)
+	p.setPos(rbrace)
+	p.print(token.RBRACE)
 }
 
 // ----------------------------------------------------------------------------
@@ -529,9 +667,7 @@ func walkBinary(e *ast.BinaryExpr) (has4, has5 bool, maxProblem int) {
 		h4, h5, mp := walkBinary(l)
 		has4 = has4 || h4
 		has5 = has5 || h5
-		if maxProblem < mp {
-			maxProblem = mp
-		}
+		maxProblem = max(maxProblem, mp)
 	}
 
 	switch r := e.Y.(type) {
@@ -544,9 +680,7 @@ func walkBinary(e *ast.BinaryExpr) (has4, has5 bool, maxProblem int) {
 		h4, h5, mp := walkBinary(r)
 		has4 = has4 || h4
 		has5 = has5 || h5
-		if maxProblem < mp {
-			maxProblem = mp
-		}
+		maxProblem = max(maxProblem, mp)
 
 	case *ast.StarExpr:
 		if e.Op == token.QUO { // `*/`
@@ -558,9 +692,7 @@ func walkBinary(e *ast.BinaryExpr) (has4, has5 bool, maxProblem int) {
 		case "/*", "&&", "&^":
 			maxProblem = 5
 		case "++", "--":
-			if maxProblem < 4 {
-				maxProblem = 4
-			}
+			maxProblem = max(maxProblem, 4)
 		}
 	}
 	return
@@ -604,6 +736,7 @@ func reduceDepth(depth int) int {
 // (Algorithm suggestion by Russ Cox.)
 //
 // The precedences are:
+//
 //	5             *  /  %  <<  >>  &  &^
 //	4             +  -  |  ^
 //	3             ==  !=  <  <=  >  >=
@@ -616,25 +749,24 @@ func reduceDepth(depth int) int {
 // To choose the cutoff, look at the whole expression but excluding primary
 // expressions (function calls, parenthesized exprs), and apply these rules:
 //
-//	1) If there is a binary operator with a right side unary operand
-//	   that would clash without a space, the cutoff must be (in order):
+//  1. If there is a binary operator with a right side unary operand
+//     that would clash without a space, the cutoff must be (in order):
 //
-//		/*	6
-//		&&	6
-//		&^	6
-//		++	5
-//		--	5
+//     /*	6
+//     &&	6
+//     &^	6
+//     ++	5
+//     --	5
 //
-//         (Comparison operators always have spaces around them.)
+//     (Comparison operators always have spaces around them.)
 //
-//	2) If there is a mix of level 5 and level 4 operators, then the cutoff
-//	   is 5 (use spaces to distinguish precedence) in Normal mode
-//	   and 4 (never use spaces) in Compact mode.
-//
-//	3) If there are no level 4 operators or no level 5 operators, then the
-//	   cutoff is 6 (always use spaces) in Normal mode
-//	   and 4 (never use spaces) in Compact mode.
+//  2. If there is a mix of level 5 and level 4 operators, then the cutoff
+//     is 5 (use spaces to distinguish precedence) in Normal mode
+//     and 4 (never use spaces) in Compact mode.
 //
+//  3. If there are no level 4 operators or no level 5 operators, then the
+//     cutoff is 6 (always use spaces) in Normal mode
+//     and 4 (never use spaces) in Compact mode.
 func (p *printer) binaryExpr(x *ast.BinaryExpr, prec1, cutoff, depth int) {
 	prec := x.Op.Precedence()
 	if prec < prec1 {
@@ -656,11 +788,12 @@ func (p *printer) binaryExpr(x *ast.BinaryExpr, prec1, cutoff, depth int) {
 	}
 	xline := p.pos.Line // before the operator (it may be on the next line!)
 	yline := p.lineFor(x.Y.Pos())
-	p.print(x.OpPos, x.Op)
+	p.setPos(x.OpPos)
+	p.print(x.Op)
 	if xline != yline && xline > 0 && yline > 0 {
 		// at least one line break, but respect an extra empty line
 		// in the source
-		if p.linebreak(yline, 1, ws, true) {
+		if p.linebreak(yline, 1, ws, true) > 0 {
 			ws = ignore
 			printBlank = false // no blank after line break
 		}
@@ -680,7 +813,7 @@ func isBinary(expr ast.Expr) bool {
 }
 
 func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
-	p.print(expr.Pos())
+	p.setPos(expr.Pos())
 
 	switch x := expr.(type) {
 	case *ast.BadExpr:
@@ -698,7 +831,8 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 
 	case *ast.KeyValueExpr:
 		p.expr(x.Key)
-		p.print(x.Colon, token.COLON, blank)
+		p.setPos(x.Colon)
+		p.print(token.COLON, blank)
 		p.expr(x.Value)
 
 	case *ast.StarExpr:
@@ -733,11 +867,18 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		}
 
 	case *ast.BasicLit:
+		if p.Config.Mode&normalizeNumbers != 0 {
+			x = normalizedNumber(x)
+		}
 		p.print(x)
 
 	case *ast.FuncLit:
-		p.expr(x.Type)
-		p.funcBody(p.distanceFrom(x.Type.Pos()), blank, x.Body)
+		p.setPos(x.Type.Pos())
+		p.print(token.FUNC)
+		// See the comment in funcDecl about how the header size is computed.
+		startCol := p.out.Column - len("func")
+		p.signature(x.Type)
+		p.funcBody(p.distanceFrom(x.Type.Pos(), startCol), blank, x.Body)
 
 	case *ast.ParenExpr:
 		if _, hasParens := x.X.(*ast.ParenExpr); hasParens {
@@ -747,7 +888,8 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		} else {
 			p.print(token.LPAREN)
 			p.expr0(x.X, reduceDepth(depth)) // parentheses undo one level of depth
-			p.print(x.Rparen, token.RPAREN)
+			p.setPos(x.Rparen)
+			p.print(token.RPAREN)
 		}
 
 	case *ast.SelectorExpr:
@@ -755,71 +897,115 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 
 	case *ast.TypeAssertExpr:
 		p.expr1(x.X, token.HighestPrec, depth)
-		p.print(token.PERIOD, x.Lparen, token.LPAREN)
+		p.print(token.PERIOD)
+		p.setPos(x.Lparen)
+		p.print(token.LPAREN)
 		if x.Type != nil {
 			p.expr(x.Type)
 		} else {
 			p.print(token.TYPE)
 		}
-		p.print(x.Rparen, token.RPAREN)
+		p.setPos(x.Rparen)
+		p.print(token.RPAREN)
 
 	case *ast.IndexExpr:
 		// TODO(gri): should treat[] like parentheses and undo one level of depth
 		p.expr1(x.X, token.HighestPrec, 1)
-		p.print(x.Lbrack, token.LBRACK)
+		p.setPos(x.Lbrack)
+		p.print(token.LBRACK)
 		p.expr0(x.Index, depth+1)
-		p.print(x.Rbrack, token.RBRACK)
+		p.setPos(x.Rbrack)
+		p.print(token.RBRACK)
+
+	case *ast.IndexListExpr:
+		// TODO(gri): as for IndexExpr, should treat [] like parentheses and undo
+		// one level of depth
+		p.expr1(x.X, token.HighestPrec, 1)
+		p.setPos(x.Lbrack)
+		p.print(token.LBRACK)
+		p.exprList(x.Lbrack, x.Indices, depth+1, commaTerm, x.Rbrack, false)
+		p.setPos(x.Rbrack)
+		p.print(token.RBRACK)
 
 	case *ast.SliceExpr:
 		// TODO(gri): should treat[] like parentheses and undo one level of depth
 		p.expr1(x.X, token.HighestPrec, 1)
-		p.print(x.Lbrack, token.LBRACK)
+		p.setPos(x.Lbrack)
+		p.print(token.LBRACK)
 		indices := []ast.Expr{x.Low, x.High}
 		if x.Max != nil {
 			indices = append(indices, x.Max)
 		}
-		for i, y := range indices {
+		// determine if we need extra blanks around ':'
+		var needsBlanks bool
+		if depth <= 1 {
+			var indexCount int
+			var hasBinaries bool
+			for _, x := range indices {
+				if x != nil {
+					indexCount++
+					if isBinary(x) {
+						hasBinaries = true
+					}
+				}
+			}
+			if indexCount > 1 && hasBinaries {
+				needsBlanks = true
+			}
+		}
+		for i, x := range indices {
 			if i > 0 {
-				// blanks around ":" if both sides exist and either side is a binary expression
-				// TODO(gri) once we have committed a variant of a[i:j:k] we may want to fine-
-				//           tune the formatting here
-				x := indices[i-1]
-				if depth <= 1 && x != nil && y != nil && (isBinary(x) || isBinary(y)) {
-					p.print(blank, token.COLON, blank)
-				} else {
-					p.print(token.COLON)
+				if indices[i-1] != nil && needsBlanks {
+					p.print(blank)
+				}
+				p.print(token.COLON)
+				if x != nil && needsBlanks {
+					p.print(blank)
 				}
 			}
-			if y != nil {
-				p.expr0(y, depth+1)
+			if x != nil {
+				p.expr0(x, depth+1)
 			}
 		}
-		p.print(x.Rbrack, token.RBRACK)
+		p.setPos(x.Rbrack)
+		p.print(token.RBRACK)
 
 	case *ast.CallExpr:
 		if len(x.Args) > 1 {
 			depth++
 		}
-		var wasIndented bool
-		if _, ok := x.Fun.(*ast.FuncType); ok {
-			// conversions to literal function types require parentheses around the type
+
+		// Conversions to literal function types or <-chan
+		// types require parentheses around the type.
+		paren := false
+		switch t := x.Fun.(type) {
+		case *ast.FuncType:
+			paren = true
+		case *ast.ChanType:
+			paren = t.Dir == ast.RECV
+		}
+		if paren {
 			p.print(token.LPAREN)
-			wasIndented = p.possibleSelectorExpr(x.Fun, token.HighestPrec, depth)
+		}
+		wasIndented := p.possibleSelectorExpr(x.Fun, token.HighestPrec, depth)
+		if paren {
 			p.print(token.RPAREN)
-		} else {
-			wasIndented = p.possibleSelectorExpr(x.Fun, token.HighestPrec, depth)
 		}
-		p.print(x.Lparen, token.LPAREN)
+
+		p.setPos(x.Lparen)
+		p.print(token.LPAREN)
 		if x.Ellipsis.IsValid() {
-			p.exprList(x.Lparen, x.Args, depth, 0, x.Ellipsis)
-			p.print(x.Ellipsis, token.ELLIPSIS)
+			p.exprList(x.Lparen, x.Args, depth, 0, x.Ellipsis, false)
+			p.setPos(x.Ellipsis)
+			p.print(token.ELLIPSIS)
 			if x.Rparen.IsValid() && p.lineFor(x.Ellipsis) < p.lineFor(x.Rparen) {
 				p.print(token.COMMA, formfeed)
 			}
 		} else {
-			p.exprList(x.Lparen, x.Args, depth, commaTerm, x.Rparen)
+			p.exprList(x.Lparen, x.Args, depth, commaTerm, x.Rparen, false)
 		}
-		p.print(x.Rparen, token.RPAREN)
+		p.setPos(x.Rparen)
+		p.print(token.RPAREN)
 		if wasIndented {
 			p.print(unindent)
 		}
@@ -830,8 +1016,9 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 			p.expr1(x.Type, token.HighestPrec, depth)
 		}
 		p.level++
-		p.print(x.Lbrace, token.LBRACE)
-		p.exprList(x.Lbrace, x.Elts, 1, commaTerm, x.Rbrace)
+		p.setPos(x.Lbrace)
+		p.print(token.LBRACE)
+		p.exprList(x.Lbrace, x.Elts, 1, commaTerm, x.Rbrace, x.Incomplete)
 		// do not insert extra line break following a /*-style comment
 		// before the closing '}' as it might break the code if there
 		// is no trailing ','
@@ -841,7 +1028,11 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		if len(x.Elts) > 0 {
 			mode |= noExtraBlank
 		}
-		p.print(mode, x.Rbrace, token.RBRACE, mode)
+		// need the initial indent to print lone comments with
+		// the proper level of indentation
+		p.print(indent, unindent, mode)
+		p.setPos(x.Rbrace)
+		p.print(token.RBRACE, mode)
 		p.level--
 
 	case *ast.Ellipsis:
@@ -864,7 +1055,7 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 
 	case *ast.FuncType:
 		p.print(token.FUNC)
-		p.signature(x.Params, x.Results)
+		p.signature(x)
 
 	case *ast.InterfaceType:
 		p.print(token.INTERFACE)
@@ -883,7 +1074,9 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		case ast.RECV:
 			p.print(token.ARROW, token.CHAN) // x.Arrow and x.Pos() are the same
 		case ast.SEND:
-			p.print(token.CHAN, x.Arrow, token.ARROW)
+			p.print(token.CHAN)
+			p.setPos(x.Arrow)
+			p.print(token.ARROW)
 		}
 		p.print(blank)
 		p.expr(x.Value)
@@ -891,8 +1084,66 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 	default:
 		panic("unreachable")
 	}
+}
 
-	return
+// normalizedNumber rewrites base prefixes and exponents
+// of numbers to use lower-case letters (0X123 to 0x123 and 1.2E3 to 1.2e3),
+// and removes leading 0's from integer imaginary literals (0765i to 765i).
+// It leaves hexadecimal digits alone.
+//
+// normalizedNumber doesn't modify the ast.BasicLit value lit points to.
+// If lit is not a number or a number in canonical format already,
+// lit is returned as is. Otherwise a new ast.BasicLit is created.
+func normalizedNumber(lit *ast.BasicLit) *ast.BasicLit {
+	if lit.Kind != token.INT && lit.Kind != token.FLOAT && lit.Kind != token.IMAG {
+		return lit // not a number - nothing to do
+	}
+	if len(lit.Value) < 2 {
+		return lit // only one digit (common case) - nothing to do
+	}
+	// len(lit.Value) >= 2
+
+	// We ignore lit.Kind because for lit.Kind == token.IMAG the literal may be an integer
+	// or floating-point value, decimal or not. Instead, just consider the literal pattern.
+	x := lit.Value
+	switch x[:2] {
+	default:
+		// 0-prefix octal, decimal int, or float (possibly with 'i' suffix)
+		if i := strings.LastIndexByte(x, 'E'); i >= 0 {
+			x = x[:i] + "e" + x[i+1:]
+			break
+		}
+		// remove leading 0's from integer (but not floating-point) imaginary literals
+		if x[len(x)-1] == 'i' && !strings.ContainsAny(x, ".e") {
+			x = strings.TrimLeft(x, "0_")
+			if x == "i" {
+				x = "0i"
+			}
+		}
+	case "0X":
+		x = "0x" + x[2:]
+		// possibly a hexadecimal float
+		if i := strings.LastIndexByte(x, 'P'); i >= 0 {
+			x = x[:i] + "p" + x[i+1:]
+		}
+	case "0x":
+		// possibly a hexadecimal float
+		i := strings.LastIndexByte(x, 'P')
+		if i == -1 {
+			return lit // nothing to do
+		}
+		x = x[:i] + "p" + x[i+1:]
+	case "0O":
+		x = "0o" + x[2:]
+	case "0o":
+		return lit // nothing to do
+	case "0B":
+		x = "0b" + x[2:]
+	case "0b":
+		return lit // nothing to do
+	}
+
+	return &ast.BasicLit{ValuePos: lit.ValuePos, Kind: lit.Kind, Value: x}
 }
 
 func (p *printer) possibleSelectorExpr(expr ast.Expr, prec1, depth int) bool {
@@ -903,19 +1154,22 @@ func (p *printer) possibleSelectorExpr(expr ast.Expr, prec1, depth int) bool {
 	return false
 }
 
-// selectorExpr handles an *ast.SelectorExpr node and returns whether x spans
+// selectorExpr handles an *ast.SelectorExpr node and reports whether x spans
 // multiple lines.
 func (p *printer) selectorExpr(x *ast.SelectorExpr, depth int, isMethod bool) bool {
 	p.expr1(x.X, token.HighestPrec, depth)
 	p.print(token.PERIOD)
 	if line := p.lineFor(x.Sel.Pos()); p.pos.IsValid() && p.pos.Line < line {
-		p.print(indent, newline, x.Sel.Pos(), x.Sel)
+		p.print(indent, newline)
+		p.setPos(x.Sel.Pos())
+		p.print(x.Sel)
 		if !isMethod {
 			p.print(unindent)
 		}
 		return true
 	}
-	p.print(x.Sel.Pos(), x.Sel)
+	p.setPos(x.Sel.Pos())
+	p.print(x.Sel)
 	return false
 }
 
@@ -973,10 +1227,12 @@ func (p *printer) stmtList(list []ast.Stmt, nindent int, nextIsRBrace bool) {
 
 // block prints an *ast.BlockStmt; it always spans at least two lines.
 func (p *printer) block(b *ast.BlockStmt, nindent int) {
-	p.print(b.Lbrace, token.LBRACE)
+	p.setPos(b.Lbrace)
+	p.print(token.LBRACE)
 	p.stmtList(b.List, nindent, true)
 	p.linebreak(p.lineFor(b.Rbrace), 1, ignore, true)
-	p.print(b.Rbrace, token.RBRACE)
+	p.setPos(b.Rbrace)
+	p.print(token.RBRACE)
 }
 
 func isTypeName(x ast.Expr) bool {
@@ -1056,14 +1312,29 @@ func (p *printer) controlClause(isForStmt bool, init ast.Stmt, expr ast.Expr, po
 	}
 }
 
+// isCompositeLitLike reports whether x is a composite literal or an expression
+// whose core is a composite literal (e.g. &T{...}), ignoring parentheses.
+func isCompositeLitLike(x ast.Expr) bool {
+	switch x := stripParensAlways(x).(type) {
+	case *ast.CompositeLit:
+		return true
+	case *ast.UnaryExpr:
+		_, ok := stripParensAlways(x.X).(*ast.CompositeLit)
+		return x.Op == token.AND && ok
+	}
+	return false
+}
+
 // indentList reports whether an expression list would look better if it
 // were indented wholesale (starting with the very first element, rather
 // than starting at the first line break).
-//
+// Currently this function is only used to improve formatting of return
+// statements.
 func (p *printer) indentList(list []ast.Expr) bool {
-	// Heuristic: indentList returns true if there are more than one multi-
-	// line element in the list, or if there is any element that is not
-	// starting on the same line as the previous one ends.
+	// Heuristic: indentList reports whether there are more than one multi-
+	// line element (such as a complex expression, but excluding composite
+	// literals) in the list, or if there is any element that is not starting
+	// on the same line as the previous one ends.
 	if len(list) >= 2 {
 		var b = p.lineFor(list[0].Pos())
 		var e = p.lineFor(list[len(list)-1].End())
@@ -1079,8 +1350,10 @@ func (p *printer) indentList(list []ast.Expr) bool {
 					// line as the previous one ended
 					return true
 				}
-				if xb < xe {
-					// x is a multi-line element
+				if xb < xe && !isCompositeLitLike(x) {
+					// x is a multi-line element but not a composite literal
+					// (composite literals have their own field indentation
+					// already, see go.dev/issue/7195)
 					n++
 				}
 				line = xe
@@ -1091,38 +1364,406 @@ func (p *printer) indentList(list []ast.Expr) bool {
 	return false
 }
 
-func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
-	p.print(stmt.Pos())
-
-	switch s := stmt.(type) {
+// sideNote prints an *errstmt.AssignIfErrStmt or *errstmt.AssignSwitchErrStmt:
+// the first statement, followed by the assignment to the error variable and
+// the if or switch statement in the error column. If an if statement has a
+// single simple statement in its body and fits on the rest of the line, it
+// is printed there. Otherwise it starts on that line and continues on the
+// following lines, which are indented to the error column so that the side
+// note forms a gutter to the right of the code. A switch statement is always
+// printed that way, with its cases in the gutter.
+//
+// With HandlerGlyphs, an if statement whose error branch has a kind other
+// than errstmt.Custom is replaced by a compact form of that branch, such as
+// "⇑ err"; see handlerGlyph.
+//
+// Comments between the first statement and the if or switch statement
+// cannot be printed in their original place. They are printed on their own
+// lines before the statement or, if they were line comments, after the side
+// note.
+func (p *printer) sideNote(s ast.Stmt) {
+	var (
+		first   ast.Stmt
+		errVar  ast.Expr
+		isShort bool
+		isInit  bool
+		tail    ast.Stmt // *ast.IfStmt or *ast.SwitchStmt
+		tailTok token.Token
+	)
+	switch s := s.(type) {
 	case *errstmt.AssignIfErrStmt:
-		p.stmt(s.FirstStmt, false)
-		for p.out.Column < p.Config.Errcol {
+		first, errVar, isShort, isInit, tail = s.FirstStmt, s.ErrVar, s.IsShort, s.IsInit, s.ErrIf()
+		tailTok = token.IF
+	case *errstmt.AssignSwitchErrStmt:
+		first, errVar, isShort, isInit, tail = s.FirstStmt, s.ErrVar, s.IsShort, s.IsInit, s.SwitchStmt
+		tailTok = token.SWITCH
+	default:
+		panic("printer: not a side note")
+	}
+	// The side note starts in the error column, or after the first
+	// statement if that extends beyond it.
+	gutter := p.errcol
+	wrap := false
+	if col := p.sideNoteColumn(first); col > gutter {
+		switch {
+		case p.Config.Mode&AutoErrcol != 0 && col <= infinity:
+			wrap = true
+		case p.Config.Mode&Terminal != 0 && p.Config.Width > 0 && col > p.Config.Width-minNoteRoom:
+			wrap = true
+		default:
+			gutter = col
+		}
+	}
+	s1, oneLine := s.(*errstmt.AssignIfErrStmt)
+	glyph := oneLine && p.Config.Mode&HandlerGlyphs != 0 && s1.Kind() != errstmt.Custom
+	oneLine = glyph || oneLine && p.sideNoteFits(s1, gutter)
+
+	// Comments in the success branch of an inverted side note stay where
+	// they are; they are printed with it, so they must not be flushed
+	// while printing the side note on one line. Comments in the error
+	// branch keep their place only if it is printed on lines of its own.
+	bodyPos := tail.Pos()
+	if s1 != nil && s1.Inverted {
+		bodyPos = s1.ErrIf().Body.Pos()
+		oneLine = oneLine && !p.hasComments(tail.Pos(), bodyPos)
+	}
+	oneLine = oneLine && !p.hasComments(bodyPos, tail.End())
+	glyph = glyph && oneLine
+	before := p.extractComments(first.End(), tail.Pos())
+	inside := p.extractComments(bodyPos, tail.End())
+	if oneLine {
+		before, inside = append(before, inside...), nil
+	}
+	lead, side := p.sideNoteComments(s1, before, oneLine)
+	if len(lead) > 0 {
+		// print pending whitespace and comments before the statement
+		p.flush(p.posFor(s.Pos()), token.ILLEGAL)
+		for _, c := range lead {
+			p.writeString(token.Position{}, trimRight(c.Text), true)
+			p.writeByte('\f', 1)
+		}
+	}
+
+	p.stmt(first, false)
+	pos := p.pos
+	if wrap {
+		// Continue on the next line. In Terminal mode, a marker
+		// ends just before the error column.
+		p.writeByte('\f', 1)
+		marker := p.Config.Mode&Terminal != 0
+		col := p.errcol
+		if marker {
+			col -= wrapMarkerWidth
+		}
+		for p.column() < col {
 			p.writeByte(' ', 1)
 		}
-		p.print(token.ASSIGN)
-		if s.IsShort {
-			p.print(token.COLON)
-		}
-		p.print(blank, s.ErrVar, token.SEMICOLON, blank)
-		sif := s.IfStmt
-		maxSize := 70 - p.Config.Errcol
-		if len(sif.Body.List) == 1 && p.nodeSize(sif.Body.List[0], maxSize) <= maxSize && sif.Else == nil {
-			p.print(token.IF)
-			p.controlClause(false, sif.Init, sif.Cond, nil)
-			p.print(sif.Body.Lbrace, token.LBRACE, blank)
-			p.stmt(sif.Body.List[0], true)
-			p.print(blank, sif.Body.Rbrace, token.RBRACE)
+		p.beginSideNote()
+		if marker {
+			p.output = append(p.output, wrapMarker...)
+			p.out.Column += wrapMarkerWidth
+		}
+	} else {
+		p.writeByte(' ', 1)
+		for p.column() < p.errcol {
+			p.writeByte(' ', 1)
+		}
+		p.beginSideNote()
+	}
+	p.pos = pos // the padding has no counterpart in the source
+	gutter = p.column()
+	if glyph {
+		p.handlerGlyph(s1)
+		for _, c := range side {
+			p.writeByte(' ', 1)
+			p.writeString(token.Position{}, trimRight(c.Text), true)
+		}
+		p.endSideNote()
+		p.successBranch(s1)
+		return
+	}
+	p.print(token.ASSIGN)
+	if isShort {
+		p.print(token.COLON)
+	}
+	p.print(blank)
+	p.expr(errVar)
+	if !isInit {
+		p.print(token.SEMICOLON)
+	}
+	p.print(blank)
+	if oneLine {
+		sif := tail.(*ast.IfStmt)
+		p.print(token.IF)
+		p.controlClause(false, sif.Init, sif.Cond, nil)
+		p.setPos(sif.Body.Lbrace)
+		p.print(token.LBRACE, blank)
+		p.stmt(sif.Body.List[0], true)
+		p.print(blank)
+		p.setPos(sif.Body.Rbrace)
+		p.print(token.RBRACE)
+		for _, c := range side {
+			p.writeByte(' ', 1)
+			p.writeString(token.Position{}, trimRight(c.Text), true)
+		}
+		p.endSideNote()
+		p.successBranch(s1)
+		return
+	}
+
+	// Print the if or switch statement separately and copy its lines,
+	// starting each continuation line in the error column.
+	p.flush(p.posFor(tail.Pos()), tailTok)
+	for i, line := range p.sideNoteLines(tail, inside) {
+		if i > 0 {
+			p.endSideNote()
+			p.writeByte('\f', 1)
+			if line == "" {
+				p.beginSideNote()
+				continue
+			}
+			for p.column() < gutter {
+				p.writeByte(' ', 1)
+			}
+			p.beginSideNote()
+		}
+		p.writeString(token.Position{}, line, true)
+	}
+	p.endSideNote()
+	p.pos = p.posFor(tail.End())
+	p.last = p.pos
+	p.lastTok = token.RBRACE
+	p.impliedSemi = true
+	if s1 != nil {
+		p.successBranch(s1)
+	}
+}
+
+// Terminal mode wraps a side note onto the next line, behind wrapMarker,
+// if fewer than minNoteRoom columns of the line width would remain for it.
+const (
+	minNoteRoom      = 20
+	wrapMarker       = "↪ "
+	wrapMarkerWidth  = 2
+	defaultNoteColor = "2" // dim
+)
+
+// beginSideNote starts the side-note part of a line: it records where the
+// part starts, for FprintSideNotes, and switches to the side-note color in
+// Terminal mode. The color takes up no column, so it bypasses the position
+// bookkeeping.
+func (p *printer) beginSideNote() {
+	p.notes = append(p.notes, notePos{line: p.out.Line, col: p.column()})
+	if p.Config.Mode&Terminal != 0 {
+		color := p.Config.NoteColor
+		if color == "" {
+			color = defaultNoteColor
+		}
+		p.output = append(p.output, "\x1b["+color+"m"...)
+	}
+}
+
+// endSideNote ends the side-note part of a line.
+func (p *printer) endSideNote() {
+	if p.Config.Mode&Terminal != 0 {
+		p.output = append(p.output, "\x1b[0m"...)
+	}
+}
+
+// handlerGlyph prints the compact form of the error branch of s, whose kind
+// is not errstmt.Custom:
+//
+//	⇑ err               Propagate
+//	⇑ wrap "reading %q" Wrap, with the format less a trailing ": %v" or ": %w"
+//	↓ log               Log
+//	✗ fatal             Fatal
+//	↻ continue          Loop, or "⇥ break", followed by any label
+func (p *printer) handlerGlyph(s *errstmt.AssignIfErrStmt) {
+	sif := s.ErrIf()
+	x := sif.Body.List[0]
+	switch s.Kind() {
+	case errstmt.Propagate:
+		p.print("⇑", blank)
+		p.expr(s.ErrVar)
+	case errstmt.Wrap:
+		p.print("⇑", blank, "wrap")
+		call := x.(*ast.ReturnStmt).Results
+		if msg, ok := wrapFormat(call[len(call)-1].(*ast.CallExpr)); ok {
+			p.print(blank, strconv.Quote(msg))
+		}
+	case errstmt.Log:
+		p.print("↓", blank, "log")
+	case errstmt.Fatal:
+		p.print("✗", blank, "fatal")
+	case errstmt.Loop:
+		b := x.(*ast.BranchStmt)
+		if b.Tok == token.CONTINUE {
+			p.print("↻", blank, "continue")
 		} else {
-			nindent := p.Config.Errcol / p.Config.Tabwidth
-			for i := 0; i < nindent; i++ {
-				p.print(indent)
+			p.print("⇥", blank, "break")
+		}
+		if b.Label != nil {
+			p.print(blank)
+			p.expr(b.Label)
+		}
+	}
+	p.pos = p.posFor(sif.Body.Rbrace)
+	p.last = p.pos
+}
+
+// wrapFormat returns the format string of a call to fmt.Errorf without a
+// trailing ": %v" or ": %w". It reports false if the format is not a string
+// literal.
+func wrapFormat(call *ast.CallExpr) (string, bool) {
+	if len(call.Args) == 0 {
+		return "", false
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	f, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", false
+	}
+	for _, suffix := range []string{": %v", ": %w"} {
+		if strings.HasSuffix(f, suffix) {
+			return strings.TrimSuffix(f, suffix), true
+		}
+	}
+	return f, true
+}
+
+// successBranch prints the statements of the success branch of an inverted
+// side note s after it, in the enclosing block. It does nothing if s is not
+// inverted.
+func (p *printer) successBranch(s *errstmt.AssignIfErrStmt) {
+	if !s.Inverted {
+		return
+	}
+	body := s.IfStmt.Body
+	p.pos = p.posFor(body.Lbrace)
+	p.last = p.pos
+	for _, x := range body.List {
+		p.linebreak(p.lineFor(x.Pos()), 1, ignore, true)
+		p.stmt(x, false)
+	}
+	p.pos = p.posFor(s.End())
+	p.last = p.pos
+	p.impliedSemi = true
+}
+
+// sideNoteFits reports whether the if statement of s can be printed
+// on the same line as its first statement, with the side note starting
+// in column gutter: its body must consist of a single statement without
+// an else branch, and, if a line width is set, the side note must fit
+// within it.
+func (p *printer) sideNoteFits(s *errstmt.AssignIfErrStmt, gutter int) bool {
+	sif := s.ErrIf()
+	if sif.Else != nil || len(sif.Body.List) != 1 {
+		return false
+	}
+	room := infinity
+	if p.Config.Width > 0 {
+		// "=: err; " or "= err " before the if statement
+		room = p.Config.Width - (gutter - 1) - p.nodeWidth(s.ErrVar, infinity) - 3
+		if s.IsShort {
+			room--
+		}
+		if !s.IsInit {
+			room--
+		}
+	}
+	// "if " [init "; "] cond " { " stmt " }"
+	size := 3 + 3 + 2
+	if sif.Init != nil {
+		size += p.nodeWidth(sif.Init, room) + 2
+	}
+	size += p.nodeWidth(sif.Cond, room)
+	size += p.nodeWidth(sif.Body.List[0], room)
+	return size <= room
+}
+
+// sideNoteLines returns the lines of the if or switch statement of a side
+// note that does not fit on one line, printed with the given comments.
+// Side notes nested in its body are aligned relative to the statement,
+// in the room remaining to the right of the error column.
+func (p *printer) sideNoteLines(tail ast.Stmt, comments []*ast.CommentGroup) []string {
+	cfg := Config{
+		Mode:     p.Config.Mode&^(RawFormat|SourcePos|Terminal|AutoErrcol|TabIndent) | UseSpaces,
+		Tabwidth: p.Config.Tabwidth,
+	}
+	if p.Config.Width > 0 {
+		cfg.Width = p.Config.Width - p.errcol
+		if cfg.Width <= 0 {
+			cfg.Width = 1
+		}
+	}
+	var buf bytes.Buffer
+	if err := cfg.fprint(&buf, p.fset, &CommentedNode{Node: tail, Comments: comments}, p.nodeSizes, nil); err != nil {
+		p.internalError(err)
+	}
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+// sideNoteComments splits the comments in groups into those that go before
+// the side-note statement s and those that go after it, on the same line.
+// If oneLine is not set, all comments go before the statement and s may
+// be nil.
+func (p *printer) sideNoteComments(s *errstmt.AssignIfErrStmt, groups []*ast.CommentGroup, oneLine bool) (lead, side []*ast.Comment) {
+	// A comment is a line comment if it starts on a line
+	// that ends one of the parts of the side note.
+	lines := map[int]bool{}
+	if oneLine {
+		sif := s.ErrIf()
+		lines[p.lineFor(s.FirstStmt.End())] = true
+		lines[p.lineFor(sif.Body.Lbrace)] = true
+		lines[p.lineFor(sif.Body.List[0].End())] = true
+		lines[p.lineFor(sif.Body.Rbrace)] = true
+	}
+	closed := false // a //-style comment ends the line
+	for _, g := range groups {
+		for _, c := range g.List {
+			if !closed && lines[p.lineFor(c.Pos())] && !strings.Contains(c.Text, "\n") {
+				side = append(side, c)
+				closed = c.Text[1] == '/'
+			} else {
+				lead = append(lead, c)
 			}
-			p.stmt(sif, false)
-			for i := 0; i < nindent; i++ {
-				p.print(unindent)
+		}
+	}
+	return lead, side
+}
+
+func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
+	p.setPos(stmt.Pos())
+
+	switch s := stmt.(type) {
+	case *errstmt.AssignIfErrStmt:
+		if p.Config.Mode&ExpandSideNotes != 0 {
+			list := s.Expand()
+			for i, x := range list {
+				if i > 0 {
+					p.linebreak(p.lineFor(x.Pos()), 1, ignore, true)
+				}
+				p.stmt(x, nextIsRBrace && i == len(list)-1)
+			}
+			break
+		}
+		p.sideNote(s)
+
+	case *errstmt.AssignSwitchErrStmt:
+		if p.Config.Mode&ExpandSideNotes != 0 {
+			list := s.Expand()
+			for i, x := range list {
+				if i > 0 {
+					p.linebreak(p.lineFor(x.Pos()), 1, ignore, true)
+				}
+				p.stmt(x, nextIsRBrace && i == len(list)-1)
 			}
+			break
 		}
+		p.sideNote(s)
 
 	case *ast.BadStmt:
 		p.print("BadStmt")
@@ -1139,10 +1780,13 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		// between (see writeWhitespace)
 		p.print(unindent)
 		p.expr(s.Label)
-		p.print(s.Colon, token.COLON, indent)
+		p.setPos(s.Colon)
+		p.print(token.COLON, indent)
 		if e, isEmpty := s.Stmt.(*ast.EmptyStmt); isEmpty {
 			if !nextIsRBrace {
-				p.print(newline, e.Pos(), token.SEMICOLON)
+				p.print(newline)
+				p.setPos(e.Pos())
+				p.print(token.SEMICOLON)
 				break
 			}
 		} else {
@@ -1157,22 +1801,27 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 	case *ast.SendStmt:
 		const depth = 1
 		p.expr0(s.Chan, depth)
-		p.print(blank, s.Arrow, token.ARROW, blank)
+		p.print(blank)
+		p.setPos(s.Arrow)
+		p.print(token.ARROW, blank)
 		p.expr0(s.Value, depth)
 
 	case *ast.IncDecStmt:
 		const depth = 1
 		p.expr0(s.X, depth+1)
-		p.print(s.TokPos, s.Tok)
+		p.setPos(s.TokPos)
+		p.print(s.Tok)
 
 	case *ast.AssignStmt:
 		var depth = 1
 		if len(s.Lhs) > 1 && len(s.Rhs) > 1 {
 			depth++
 		}
-		p.exprList(s.Pos(), s.Lhs, depth, 0, s.TokPos)
-		p.print(blank, s.TokPos, s.Tok, blank)
-		p.exprList(s.TokPos, s.Rhs, depth, 0, token.NoPos)
+		p.exprList(s.Pos(), s.Lhs, depth, 0, s.TokPos, false)
+		p.print(blank)
+		p.setPos(s.TokPos)
+		p.print(s.Tok, blank)
+		p.exprList(s.TokPos, s.Rhs, depth, 0, token.NoPos, false)
 
 	case *ast.GoStmt:
 		p.print(token.GO, blank)
@@ -1193,10 +1842,12 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 			// lead to more nicely formatted code in general.
 			if p.indentList(s.Results) {
 				p.print(indent)
-				p.exprList(s.Pos(), s.Results, 1, noIndent, token.NoPos)
+				// Use NoPos so that a newline never goes before
+				// the results (see issue #32854).
+				p.exprList(token.NoPos, s.Results, 1, noIndent, token.NoPos, false)
 				p.print(unindent)
 			} else {
-				p.exprList(s.Pos(), s.Results, 1, 0, token.NoPos)
+				p.exprList(token.NoPos, s.Results, 1, 0, token.NoPos, false)
 			}
 		}
 
@@ -1232,11 +1883,12 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 	case *ast.CaseClause:
 		if s.List != nil {
 			p.print(token.CASE, blank)
-			p.exprList(s.Pos(), s.List, 1, 0, s.Colon)
+			p.exprList(s.Pos(), s.List, 1, 0, s.Colon, false)
 		} else {
 			p.print(token.DEFAULT)
 		}
-		p.print(s.Colon, token.COLON)
+		p.setPos(s.Colon)
+		p.print(token.COLON)
 		p.stmtList(s.Body, 1, nextIsRBrace)
 
 	case *ast.SwitchStmt:
@@ -1263,7 +1915,8 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		} else {
 			p.print(token.DEFAULT)
 		}
-		p.print(s.Colon, token.COLON)
+		p.setPos(s.Colon)
+		p.print(token.COLON)
 		p.stmtList(s.Body, 1, nextIsRBrace)
 
 	case *ast.SelectStmt:
@@ -1271,7 +1924,10 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		body := s.Body
 		if len(body.List) == 0 && !p.commentBefore(p.posFor(body.Rbrace)) {
 			// print empty select statement w/o comments on one line
-			p.print(body.Lbrace, token.LBRACE, body.Rbrace, token.RBRACE)
+			p.setPos(body.Lbrace)
+			p.print(token.LBRACE)
+			p.setPos(body.Rbrace)
+			p.print(token.RBRACE)
 		} else {
 			p.block(body, 0)
 		}
@@ -1288,10 +1944,13 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 			if s.Value != nil {
 				// use position of value following the comma as
 				// comma position for correct comment placement
-				p.print(s.Value.Pos(), token.COMMA, blank)
+				p.setPos(s.Value.Pos())
+				p.print(token.COMMA, blank)
 				p.expr(s.Value)
 			}
-			p.print(blank, s.TokPos, s.Tok, blank)
+			p.print(blank)
+			p.setPos(s.TokPos)
+			p.print(s.Tok, blank)
 		}
 		p.print(token.RANGE, blank)
 		p.expr(stripParens(s.X))
@@ -1299,10 +1958,8 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.block(s.Body, 1)
 
 	default:
-		panic("unreachable: " + fmt.Sprintf("%T", stmt))
+		panic("unreachable")
 	}
-
-	return
 }
 
 // ----------------------------------------------------------------------------
@@ -1315,24 +1972,23 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 //
 // For example, the declaration:
 //
-//	const (
-//		foobar int = 42 // comment
-//		x          = 7  // comment
-//		foo
-//              bar = 991
-//	)
+//		const (
+//			foobar int = 42 // comment
+//			x          = 7  // comment
+//			foo
+//	             bar = 991
+//		)
 //
 // leads to the type/values matrix below. A run of value columns (V) can
 // be moved into the type column if there is no type for any of the values
 // in that column (we only move entire columns so that they align properly).
 //
-//	matrix        formatted     result
-//                    matrix
-//	T  V    ->    T  V     ->   true      there is a T and so the type
-//	-  V          -  V          true      column must be kept
-//	-  -          -  -          false
-//	-  V          V  -          false     V is moved into T column
-//
+//		matrix        formatted     result
+//	                   matrix
+//		T  V    ->    T  V     ->   true      there is a T and so the type
+//		-  V          -  V          true      column must be kept
+//		-  -          -  -          false
+//		-  V          V  -          false     V is moved into T column
 func keepTypeColumn(specs []ast.Spec) []bool {
 	m := make([]bool, len(specs))
 
@@ -1386,7 +2042,7 @@ func (p *printer) valueSpec(s *ast.ValueSpec, keepType bool) {
 	}
 	if s.Values != nil {
 		p.print(vtab, token.ASSIGN, blank)
-		p.exprList(token.NoPos, s.Values, 1, 0, token.NoPos)
+		p.exprList(token.NoPos, s.Values, 1, 0, token.NoPos, false)
 		extraTabs--
 	}
 	if s.Comment != nil {
@@ -1443,7 +2099,6 @@ func sanitizeImportPath(lit *ast.BasicLit) *ast.BasicLit {
 // The parameter n is the number of specs in the group. If doIndent is set,
 // multi-line identifier lists in the spec are indented when the first
 // linebreak is encountered.
-//
 func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 	switch s := spec.(type) {
 	case *ast.ImportSpec:
@@ -1454,7 +2109,7 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 		}
 		p.expr(sanitizeImportPath(s.Path))
 		p.setComment(s.Comment)
-		p.print(s.EndPos)
+		p.setPos(s.EndPos)
 
 	case *ast.ValueSpec:
 		if n != 1 {
@@ -1468,13 +2123,16 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 		}
 		if s.Values != nil {
 			p.print(blank, token.ASSIGN, blank)
-			p.exprList(token.NoPos, s.Values, 1, 0, token.NoPos)
+			p.exprList(token.NoPos, s.Values, 1, 0, token.NoPos, false)
 		}
 		p.setComment(s.Comment)
 
 	case *ast.TypeSpec:
 		p.setComment(s.Doc)
 		p.expr(s.Name)
+		if s.TypeParams != nil {
+			p.parameters(s.TypeParams, typeTParam)
+		}
 		if n == 1 {
 			p.print(blank)
 		} else {
@@ -1493,11 +2151,13 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 
 func (p *printer) genDecl(d *ast.GenDecl) {
 	p.setComment(d.Doc)
-	p.print(d.Pos(), d.Tok, blank)
+	p.setPos(d.Pos())
+	p.print(d.Tok, blank)
 
-	if d.Lparen.IsValid() {
+	if d.Lparen.IsValid() || len(d.Specs) != 1 {
 		// group of parenthesized declarations
-		p.print(d.Lparen, token.LPAREN)
+		p.setPos(d.Lparen)
+		p.print(token.LPAREN)
 		if n := len(d.Specs); n > 0 {
 			p.print(indent, formfeed)
 			if n > 1 && (d.Tok == token.CONST || d.Tok == token.VAR) {
@@ -1524,19 +2184,66 @@ func (p *printer) genDecl(d *ast.GenDecl) {
 			}
 			p.print(unindent, formfeed)
 		}
-		p.print(d.Rparen, token.RPAREN)
+		p.setPos(d.Rparen)
+		p.print(token.RPAREN)
 
-	} else {
+	} else if len(d.Specs) > 0 {
 		// single declaration
 		p.spec(d.Specs[0], 1, true)
 	}
 }
 
+// sizeCounter is an io.Writer which counts the number of bytes written
+// and their display width, as well as whether a newline character was seen.
+type sizeCounter struct {
+	hasNewline bool
+	size       int
+	width      int
+}
+
+func (c *sizeCounter) Write(p []byte) (int, error) {
+	if !c.hasNewline {
+		for _, b := range p {
+			if b == '\n' || b == '\f' {
+				c.hasNewline = true
+				break
+			}
+		}
+	}
+	c.size += len(p)
+	// The trimmer splits the output only at ASCII characters and
+	// tabwriter.Escape bytes, so p holds whole runes.
+	c.width += displayWidth(string(p))
+	return len(p), nil
+}
+
+// nodeWidth is like nodeSize, but measures the display width of n rather
+// than its length in bytes; see displayWidth. It is used to place side
+// notes. Other layout decisions use nodeSize, as gofmt does.
+func (p *printer) nodeWidth(n ast.Node, maxWidth int) int {
+	width, found := p.nodeWidths[n]
+	if !found {
+		width = infinity + 1 // assume n doesn't fit
+		cfg := Config{Mode: RawFormat}
+		var counter sizeCounter
+		if err := cfg.fprint(&counter, p.fset, n, p.nodeSizes, nil); err == nil && !counter.hasNewline {
+			width = counter.width
+		}
+		if p.nodeWidths == nil {
+			p.nodeWidths = make(map[ast.Node]int)
+		}
+		p.nodeWidths[n] = width
+	}
+	if width > maxWidth {
+		return maxWidth + 1
+	}
+	return width
+}
+
 // nodeSize determines the size of n in chars after formatting.
 // The result is <= maxSize if the node fits on one line with at
 // most maxSize chars and the formatted output doesn't contain
 // any control chars. Otherwise, the result is > maxSize.
-//
 func (p *printer) nodeSize(n ast.Node, maxSize int) (size int) {
 	// nodeSize invokes the printer, which may invoke nodeSize
 	// recursively. For deep composite literal nests, this can
@@ -1553,22 +2260,28 @@ func (p *printer) nodeSize(n ast.Node, maxSize int) (size int) {
 	// style so that we always get the same decision; print
 	// in RawFormat
 	cfg := Config{Mode: RawFormat}
-	var buf bytes.Buffer
-	if err := cfg.fprint(&buf, p.fset, n, p.nodeSizes); err != nil {
+	var counter sizeCounter
+	if err := cfg.fprint(&counter, p.fset, n, p.nodeSizes, nil); err != nil {
 		return
 	}
-	if buf.Len() <= maxSize {
-		for _, ch := range buf.Bytes() {
-			if ch < ' ' {
-				return
-			}
-		}
-		size = buf.Len() // n fits
+	if counter.size <= maxSize && !counter.hasNewline {
+		// n fits in a single line
+		size = counter.size
 		p.nodeSizes[n] = size
 	}
 	return
 }
 
+// numLines returns the number of lines spanned by node n in the original source.
+func (p *printer) numLines(n ast.Node) int {
+	if from := n.Pos(); from.IsValid() {
+		if to := n.End(); to.IsValid() {
+			return p.lineFor(to) - p.lineFor(from) + 1
+		}
+	}
+	return infinity
+}
+
 // bodySize is like nodeSize but it is specialized for *ast.BlockStmt's.
 func (p *printer) bodySize(b *ast.BlockStmt, maxSize int) int {
 	pos1 := b.Pos()
@@ -1600,7 +2313,6 @@ func (p *printer) bodySize(b *ast.BlockStmt, maxSize int) int {
 // the block is printed on the current line, without line breaks, spaced from the header
 // by sep. Otherwise the block's opening "{" is printed on the current line, followed by
 // lines for the block's statements and its closing "}".
-//
 func (p *printer) funcBody(headerSize int, sep whiteSpace, b *ast.BlockStmt) {
 	if b == nil {
 		return
@@ -1614,7 +2326,9 @@ func (p *printer) funcBody(headerSize int, sep whiteSpace, b *ast.BlockStmt) {
 
 	const maxSize = 100
 	if headerSize+p.bodySize(b, maxSize) <= maxSize {
-		p.print(sep, b.Lbrace, token.LBRACE)
+		p.print(sep)
+		p.setPos(b.Lbrace)
+		p.print(token.LBRACE)
 		if len(b.List) > 0 {
 			p.print(blank)
 			for i, s := range b.List {
@@ -1625,44 +2339,167 @@ func (p *printer) funcBody(headerSize int, sep whiteSpace, b *ast.BlockStmt) {
 			}
 			p.print(blank)
 		}
-		p.print(noExtraLinebreak, b.Rbrace, token.RBRACE, noExtraLinebreak)
+		p.print(noExtraLinebreak)
+		p.setPos(b.Rbrace)
+		p.print(token.RBRACE, noExtraLinebreak)
 		return
 	}
 
 	if sep != ignore {
 		p.print(blank) // always use blank
 	}
+	if p.Config.Mode&AutoErrcol != 0 {
+		defer func(errcol int) {
+			p.errcol = errcol
+		}(p.errcol)
+		p.errcol = p.autoErrcol(b)
+	}
 	p.block(b, 1)
 }
 
-// distanceFrom returns the column difference between from and p.pos (the current
-// estimated position) if both are on the same line; if they are on different lines
-// (or unknown) the result is infinity.
-func (p *printer) distanceFrom(from token.Pos) int {
-	if from.IsValid() && p.pos.IsValid() {
-		if f := p.posFor(from); f.Line == p.pos.Line {
-			return p.pos.Column - f.Column
+// autoErrcol returns the error column for the function body b: the column
+// just past its widest statement that has a side note and fits within
+// MaxErrcol, but at least MinErrcol. Statements with side notes in nested
+// function literals and in the error handling of other side notes are not
+// considered.
+func (p *printer) autoErrcol(b *ast.BlockStmt) int {
+	max := p.Config.MaxErrcol
+	if max == 0 {
+		max = infinity
+		if p.Config.Width > 0 {
+			max = p.Config.Width - minNoteRoom
+		}
+	}
+	errcol := p.Config.MinErrcol
+	indent := p.indent
+	defer func() { p.indent = indent }()
+	var stmts func(list []ast.Stmt)
+	stmts = func(list []ast.Stmt) {
+		p.indent++
+		defer func() { p.indent-- }()
+		for _, s := range list {
+			var first ast.Stmt
+			switch s := s.(type) {
+			case *errstmt.AssignIfErrStmt:
+				first = s.FirstStmt
+				if s.Inverted {
+					p.indent--
+					stmts(s.IfStmt.Body.List)
+					p.indent++
+				}
+			case *errstmt.AssignSwitchErrStmt:
+				first = s.FirstStmt
+			case *ast.LabeledStmt:
+				p.indent--
+				stmts([]ast.Stmt{s.Stmt})
+				p.indent++
+			case *ast.BlockStmt:
+				stmts(s.List)
+			case *ast.IfStmt:
+				for s != nil {
+					stmts(s.Body.List)
+					switch e := s.Else.(type) {
+					case *ast.BlockStmt:
+						stmts(e.List)
+						s = nil
+					case *ast.IfStmt:
+						s = e
+					default:
+						s = nil
+					}
+				}
+			case *ast.ForStmt:
+				stmts(s.Body.List)
+			case *ast.RangeStmt:
+				stmts(s.Body.List)
+			case *ast.SwitchStmt:
+				clauses(s.Body, stmts)
+			case *ast.TypeSwitchStmt:
+				clauses(s.Body, stmts)
+			case *ast.SelectStmt:
+				clauses(s.Body, stmts)
+			}
+			if first != nil {
+				if col := p.sideNoteColumn(first); col <= max && col > errcol {
+					errcol = col
+				}
+			}
+		}
+	}
+	stmts(b.List)
+	return errcol
+}
+
+// clauses calls stmts with the statements of each case or communication
+// clause in the body of a switch or select statement.
+func clauses(body *ast.BlockStmt, stmts func([]ast.Stmt)) {
+	for _, c := range body.List {
+		switch c := c.(type) {
+		case *ast.CaseClause:
+			stmts(c.Body)
+		case *ast.CommClause:
+			stmts(c.Body)
 		}
 	}
+}
+
+// sideNoteColumn returns the column in which a side note following the
+// statement first would start if it were not padded to the error column,
+// at the current indentation. It exceeds infinity if first does not fit
+// on one line.
+func (p *printer) sideNoteColumn(first ast.Stmt) int {
+	return 1 + (p.Config.Indent+p.indent)*p.tabwidth() + p.nodeWidth(first, infinity) + 1
+}
+
+// column returns the visual column of the current output position, in
+// which each indentation tab takes up Tabwidth columns. The tabs are at the
+// start of the line, so this holds in every mode: the tabwriter expands
+// them to Tabwidth spaces, and a reader's tab stops are assumed to match.
+// Other characters take up their display width; see displayWidth.
+func (p *printer) column() int {
+	return p.out.Column + p.lineIndent*(p.tabwidth()-1) + p.lineExtra
+}
+
+// tabwidth returns the width of an indentation tab.
+func (p *printer) tabwidth() int {
+	if p.Config.Tabwidth <= 0 {
+		return 8
+	}
+	return p.Config.Tabwidth
+}
+
+// distanceFrom returns the column difference between p.out (the current output
+// position) and startOutCol. If the start position is on a different line from
+// the current position (or either is unknown), the result is infinity.
+func (p *printer) distanceFrom(startPos token.Pos, startOutCol int) int {
+	if startPos.IsValid() && p.pos.IsValid() && p.posFor(startPos).Line == p.pos.Line {
+		return p.out.Column - startOutCol
+	}
 	return infinity
 }
 
 func (p *printer) funcDecl(d *ast.FuncDecl) {
 	p.setComment(d.Doc)
-	p.print(d.Pos(), token.FUNC, blank)
+	p.setPos(d.Pos())
+	p.print(token.FUNC, blank)
+	// We have to save startCol only after emitting FUNC; otherwise it can be on a
+	// different line (all whitespace preceding the FUNC is emitted only when the
+	// FUNC is emitted).
+	startCol := p.out.Column - len("func ")
 	if d.Recv != nil {
-		p.parameters(d.Recv) // method: print receiver
+		p.parameters(d.Recv, funcParam) // method: print receiver
 		p.print(blank)
 	}
 	p.expr(d.Name)
-	p.signature(d.Type.Params, d.Type.Results)
-	p.funcBody(p.distanceFrom(d.Pos()), vtab, d.Body)
+	p.signature(d.Type)
+	p.funcBody(p.distanceFrom(d.Pos(), startCol), vtab, d.Body)
 }
 
 func (p *printer) decl(decl ast.Decl) {
 	switch d := decl.(type) {
 	case *ast.BadDecl:
-		p.print(d.Pos(), "BadDecl")
+		p.setPos(d.Pos())
+		p.print("BadDecl")
 	case *ast.GenDecl:
 		p.genDecl(d)
 	case *ast.FuncDecl:
@@ -1705,7 +2542,9 @@ func (p *printer) declList(list []ast.Decl) {
 			if prev != tok || getDoc(d) != nil {
 				min = 2
 			}
-			p.linebreak(p.lineFor(d.Pos()), min, ignore, false)
+			// start a new section if the next declaration is a function
+			// that spans multiple lines (see also issue #19544)
+			p.linebreak(p.lineFor(d.Pos()), min, ignore, tok == token.FUNC && p.numLines(d) > 1)
 		}
 		p.decl(d)
 	}
@@ -1713,7 +2552,8 @@ func (p *printer) declList(list []ast.Decl) {
 
 func (p *printer) file(src *ast.File) {
 	p.setComment(src.Doc)
-	p.print(src.Pos(), token.PACKAGE, blank)
+	p.setPos(src.Pos())
+	p.print(token.PACKAGE, blank)
 	p.expr(src.Name)
 	p.declList(src.Decls)
 	p.print(newline)
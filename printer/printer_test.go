@@ -0,0 +1,156 @@
+package printer
+
+import (
+	"bytes"
+	"flag"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jba/errside/parser"
+)
+
+const dataDir = "testdata"
+
+var update = flag.Bool("update", false, "update golden files")
+
+// gofmt prints side notes as gofmt would print the code they replace.
+var gofmt = &Config{Mode: ExpandSideNotes | UseSpaces | TabIndent, Tabwidth: 8}
+
+// sideNotes prints side notes as errside does by default.
+var sideNotes = &Config{Mode: UseSpaces, Tabwidth: 4, Errcol: 50, Width: 100}
+
+// glyphs abbreviates the common error handlers.
+var glyphs = &Config{Mode: UseSpaces | HandlerGlyphs, Tabwidth: 4, Errcol: 50, Width: 100}
+
+// tabs indents with tabs, as gofmt does, and keeps the side notes.
+var tabs = &Config{Mode: TabIndent, Tabwidth: 8, Errcol: 50, Width: 100}
+
+// terminal prints side notes for a terminal 80 columns wide.
+var terminal = &Config{Mode: UseSpaces | Terminal, Tabwidth: 4, Errcol: 36, Width: 80, NoteColor: "2"}
+
+// autoErrcol prints side notes as errside -auto does by default.
+var autoErrcol = &Config{Mode: UseSpaces | AutoErrcol, Tabwidth: 4, Width: 100, MinErrcol: 40}
+
+var data = []struct {
+	source, golden string
+	cfg            *Config
+}{
+	{"sidenotes.input", "sidenotes.golden", gofmt},
+	{"sidenotes.input", "sidenotes.input", sideNotes},
+	{"padding.input", "padding.golden", sideNotes},
+	{"padding.golden", "padding.golden", sideNotes},
+	{"autoerrcol.input", "autoerrcol.golden", autoErrcol},
+	{"autoerrcol.golden", "autoerrcol.golden", autoErrcol},
+	{"autoerrcol.golden", "autoerrcol.expanded", gofmt},
+	{"terminal.input", "terminal.golden", terminal},
+	{"tabs.input", "tabs.golden", tabs},
+	{"tabs.golden", "tabs.golden", tabs},
+	{"tabs.golden", "tabs.spaces", sideNotes},
+	{"tabs.spaces", "tabs.golden", tabs},
+	{"width.input", "width.golden", sideNotes},
+	{"width.golden", "width.golden", sideNotes},
+	{"glyphs.input", "glyphs.golden", glyphs},
+	{"generics.input", "generics.input", sideNotes},
+	{"generics.input", "generics.golden", gofmt},
+	{"errvars.input", "errvars.golden", autoErrcol},
+	{"errvars.golden", "errvars.golden", autoErrcol},
+	{"errvars.golden", "errvars.expanded", gofmt},
+}
+
+// reprint parses src in SideNotes mode and prints it with cfg.
+func reprint(src []byte, cfg *Config) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SideNotes)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestFiles(t *testing.T) {
+	for _, e := range data {
+		t.Run(e.golden, func(t *testing.T) {
+			source := filepath.Join(dataDir, e.source)
+			golden := filepath.Join(dataDir, e.golden)
+			src, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := reprint(src, e.cfg)
+			if err != nil {
+				t.Fatalf("%s: %v", source, err)
+			}
+			if *update && e.source != e.golden {
+				if err := os.WriteFile(golden, res, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			gld, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(res, gld) {
+				t.Errorf("%s: printed with %+v differs from %s:\n%s", source, *e.cfg, golden, res)
+			}
+			if e.cfg == gofmt {
+				// Expanded side notes must be the code that gofmt prints.
+				fmted, err := format.Source(gld)
+				if err != nil {
+					t.Fatalf("%s: %v", golden, err)
+				}
+				if !bytes.Equal(fmted, gld) {
+					t.Errorf("%s is not gofmt output:\n%s", golden, fmted)
+				}
+			}
+		})
+	}
+}
+
+func TestFprintSideNotes(t *testing.T) {
+	const src = `package p
+
+func f() error {
+	s := g(" 世界") =: err; if err != nil { return err }
+	n := h() =: err; if err != nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.SideNotes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	notes, err := sideNotes.FprintSideNotes(&buf, fset, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	var got []string
+	for _, n := range notes {
+		got = append(got, lines[n.Line-1][n.Offset:])
+	}
+	want := []string{
+		"=: err; if err != nil { return err }",
+		"=: err; if err != nil {",
+		"    log.Print(err)",
+		"    return err",
+		"}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("side-note parts of lines:\ngot  %q\nwant %q\noutput:\n%s", got, want, buf.Bytes())
+	}
+}
@@ -0,0 +1,120 @@
+package printer
+
+import (
+	"testing"
+	"unicode"
+)
+
+func TestRuneWidth(t *testing.T) {
+	for _, test := range []struct {
+		r    rune
+		want int
+	}{
+		{'a', 1},
+		{'é', 1},
+		{'ж', 1},
+		{'─', 1},      // box drawing: ambiguous, narrow outside East Asian contexts
+		{'①', 1},      // ambiguous
+		{'ｶ', 1},      // halfwidth katakana
+		{'\u0301', 0}, // combining acute accent
+		{'\u200d', 0}, // zero-width joiner
+		{'\ufe0f', 0}, // variation selector 16
+		{'世', 2},
+		{'あ', 2},
+		{'カ', 2},
+		{'한', 2},
+		{'Ａ', 2}, // fullwidth
+		{'、', 2},
+		{'㉈', 1}, // circled number on black square: ambiguous
+		{'⌚', 2},
+		{'😀', 2},
+		{'🦀', 2},
+		{'🫠', 2},
+		{'\U00020000', 2},
+		{'\U0001aff0', 2}, // katakana letter minnan tone-2
+	} {
+		if got := runeWidth(test.r); got != test.want {
+			t.Errorf("runeWidth(%U) = %d, want %d", test.r, got, test.want)
+		}
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"café", 4},
+		{"cafe\u0301", 4},
+		{"世界", 4},
+		{"\U0001F469\u200d\U0001F4BB", 4}, // two wide emoji joined: terminals differ, so count both
+		{"\u2764\ufe0f", 1},
+	} {
+		if got := displayWidth(test.s); got != test.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", test.s, got, test.want)
+		}
+	}
+}
+
+// The table must be usable by unicode.Is, which searches it in order.
+func TestWideTableIsSorted(t *testing.T) {
+	last := rune(-1)
+	check := func(lo, hi, stride rune) {
+		if lo > hi || stride <= 0 || (hi-lo)%stride != 0 || lo <= last {
+			t.Errorf("bad range %U-%U (stride %d) after %U", lo, hi, stride, last)
+		}
+		last = hi
+	}
+	for _, r := range wide.R16 {
+		check(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	for _, r := range wide.R32 {
+		check(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	if wide.LatinOffset != 0 {
+		t.Errorf("LatinOffset = %d, want 0", wide.LatinOffset)
+	}
+}
+
+// All characters of these scripts are wide, except for combining marks and
+// the halfwidth forms.
+func TestWideScripts(t *testing.T) {
+	halfwidth := &unicode.RangeTable{R16: []unicode.Range16{{0xff61, 0xffdc, 1}}}
+	for name, script := range map[string]*unicode.RangeTable{
+		"Han":      unicode.Han,
+		"Hiragana": unicode.Hiragana,
+		"Katakana": unicode.Katakana,
+		"Tangut":   unicode.Tangut,
+		"Hangul syllables": {
+			R16: []unicode.Range16{{0xac00, 0xd7a3, 1}},
+		},
+	} {
+		var bad []rune
+		forEach(script, func(r rune) {
+			if unicode.Is(halfwidth, r) || unicode.In(r, unicode.Mn, unicode.Me) {
+				return
+			}
+			if !unicode.Is(wide, r) {
+				bad = append(bad, r)
+			}
+		})
+		if len(bad) > 0 {
+			t.Errorf("%s: %d characters are not wide, such as %U", name, len(bad), bad[0])
+		}
+	}
+}
+
+func forEach(tab *unicode.RangeTable, f func(rune)) {
+	for _, r := range tab.R16 {
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			f(c)
+		}
+	}
+	for _, r := range tab.R32 {
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			f(c)
+		}
+	}
+}
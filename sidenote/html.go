@@ -0,0 +1,241 @@
+package sidenote
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/errstmt"
+	"github.com/jba/errside/printer"
+	"github.com/jba/errside/types"
+)
+
+// FprintHTML prints file, which may contain side notes, to w as an HTML
+// fragment, to be placed in a document started with HTMLHeader. Code and
+// side notes are laid out in separate columns of a grid and highlighted by
+// token class. Clicking a side note collapses it to a summary of its error
+// handling, and its title holds the standard Go code that it replaced.
+func (cfg *Config) FprintHTML(w io.Writer, fset *token.FileSet, file *ast.File) error {
+	var buf bytes.Buffer
+	notePos, err := cfg.printerConfig().FprintSideNotes(&buf, fset, file)
+	if err != nil {
+		return err
+	}
+
+	// Split the lines into code and side notes. A line whose code is
+	// blank continues the side note of the line before it.
+	starts := make(map[int]int) // line index -> offset of its side note
+	for _, n := range notePos {
+		starts[n.Line-1] = n.Offset
+	}
+	type row struct {
+		code string
+		note []string
+	}
+	var rows []row
+	for i, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		offset, ok := starts[i]
+		if !ok {
+			rows = append(rows, row{code: line})
+			continue
+		}
+		offset = min(offset, len(line))
+		code, note := line[:offset], line[offset:]
+		if strings.TrimSpace(code) == "" && len(rows) > 0 && rows[len(rows)-1].note != nil {
+			rows[len(rows)-1].note = append(rows[len(rows)-1].note, note)
+			continue
+		}
+		rows = append(rows, row{code: strings.TrimRight(code, " "), note: []string{note}})
+	}
+
+	codes := make([]string, len(rows))
+	for i, r := range rows {
+		codes[i] = r.code
+	}
+	codes = highlight(strings.Join(codes, "\n"))
+	notes := printedNotes(file)
+	var out bytes.Buffer
+	out.WriteString("<div class=\"errside\">\n")
+	for i, r := range rows {
+		fmt.Fprintf(&out, "<div class=\"code\">%s</div>", codes[i])
+		if r.note == nil {
+			out.WriteString("<div></div>\n")
+			continue
+		}
+		var summary, title string
+		if len(notes) > 0 {
+			summary, title = noteSummary(notes[0]), expanded(fset, notes[0])
+			notes = notes[1:]
+		}
+		fmt.Fprintf(&out, "<details class=\"note\" open title=\"%s\">", html.EscapeString(title))
+		for j, line := range highlight(strings.Join(r.note, "\n")) {
+			if j == 0 {
+				fmt.Fprintf(&out, "<summary><span class=\"short\">%s</span><span class=\"full\">%s</span></summary>", html.EscapeString(summary), line)
+			} else {
+				fmt.Fprintf(&out, "<div>%s</div>", line)
+			}
+		}
+		out.WriteString("</details>\n")
+	}
+	out.WriteString("</div>\n")
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// HTMLHeader returns the start of an HTML document with the given title,
+// which holds the style of the fragments that FprintHTML prints. The
+// document ends with HTMLFooter.
+func HTMLHeader(title string) string {
+	return "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + html.EscapeString(title) + "</title>\n" +
+		htmlStyle + "</head>\n<body>\n"
+}
+
+// HTMLFooter ends a document started with HTMLHeader.
+const HTMLFooter = "</body>\n</html>\n"
+
+const htmlStyle = `<style>
+.errside { display: grid; grid-template-columns: max-content 1fr; column-gap: 2em; font-family: monospace; white-space: pre; line-height: 1.4; }
+.errside > div, .errside div, .errside summary { min-height: 1.4em; }
+.errside .note { color: #555; background: #f5f5f0; border-left: 2px solid #ccc; padding-left: 0.5em; }
+.errside .note summary { list-style: none; cursor: pointer; }
+.errside .note summary::-webkit-details-marker { display: none; }
+.errside .note[open] .short, .errside .note:not([open]) .full { display: none; }
+.errside .short { font-style: italic; }
+.errside .comment { color: #6a737d; }
+.errside .keyword { color: #d73a49; }
+.errside .literal { color: #032f62; }
+.errside .operator { color: #555; }
+</style>
+`
+
+// printedNotes returns the side notes in file in the order in which the
+// printer marks them: by the end of their first statement. Side notes in
+// the error handling of another are printed as part of it, so they are
+// omitted.
+func printedNotes(file *ast.File) []ast.Stmt {
+	var notes []ast.Stmt
+	var visit func(ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *errstmt.AssignIfErrStmt:
+			notes = append(notes, n)
+			ast.Inspect(n.FirstStmt, visit)
+			if n.Inverted {
+				ast.Inspect(n.IfStmt.Body, visit)
+			}
+			return false
+		case *errstmt.AssignSwitchErrStmt:
+			notes = append(notes, n)
+			ast.Inspect(n.FirstStmt, visit)
+			return false
+		}
+		return true
+	}
+	ast.Inspect(file, visit)
+	first := func(s ast.Stmt) ast.Stmt {
+		if s, ok := s.(*errstmt.AssignIfErrStmt); ok {
+			return s.FirstStmt
+		}
+		return s.(*errstmt.AssignSwitchErrStmt).FirstStmt
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return first(notes[i]).End() < first(notes[j]).End()
+	})
+	return notes
+}
+
+// noteSummary returns the text of a collapsed side note: its error
+// variable and the kind of its error handling.
+func noteSummary(s ast.Stmt) string {
+	switch s := s.(type) {
+	case *errstmt.AssignIfErrStmt:
+		return types.ExprString(s.ErrVar) + ": " + s.Kind().String()
+	case *errstmt.AssignSwitchErrStmt:
+		return types.ExprString(s.ErrVar) + ": switch"
+	}
+	return ""
+}
+
+// expanded returns the standard Go code that the side note s replaced.
+func expanded(fset *token.FileSet, s ast.Stmt) string {
+	var list []ast.Stmt
+	switch s := s.(type) {
+	case *errstmt.AssignIfErrStmt:
+		list = s.Expand()
+	case *errstmt.AssignSwitchErrStmt:
+		list = s.Expand()
+	}
+	var buf bytes.Buffer
+	pcfg := &printer.Config{Mode: printer.ExpandSideNotes | printer.UseSpaces, Tabwidth: 4}
+	if err := pcfg.Fprint(&buf, fset, list); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// highlight returns the lines of the Go text src as HTML, with each token
+// in a span whose class is that of the token: see tokenClass.
+func highlight(src string) []string {
+	fset := token.NewFileSet()
+	f := fset.AddFile("", -1, len(src))
+	var sc scanner.Scanner
+	sc.Init(f, []byte(src), nil, scanner.ScanComments)
+	var b strings.Builder
+	end := 0
+	for {
+		pos, tok, lit := sc.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // automatically inserted
+		}
+		offs := f.Offset(pos)
+		text := lit
+		if text == "" {
+			text = tok.String()
+		}
+		if offs < end || offs+len(text) > len(src) {
+			break
+		}
+		b.WriteString(html.EscapeString(src[end:offs]))
+		text = src[offs : offs+len(text)]
+		class := tokenClass(tok)
+		for i, part := range strings.Split(text, "\n") {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			if class == "" || part == "" {
+				b.WriteString(html.EscapeString(part))
+				continue
+			}
+			fmt.Fprintf(&b, "<span class=\"%s\">%s</span>", class, html.EscapeString(part))
+		}
+		end = offs + len(text)
+	}
+	b.WriteString(html.EscapeString(src[end:]))
+	return strings.Split(b.String(), "\n")
+}
+
+// tokenClass returns the HTML class of a token, or "" for none.
+func tokenClass(tok token.Token) string {
+	switch {
+	case tok == token.COMMENT:
+		return "comment"
+	case tok.IsKeyword():
+		return "keyword"
+	case tok == token.IDENT:
+		return "ident"
+	case tok.IsLiteral():
+		return "literal"
+	case tok.IsOperator():
+		return "operator"
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package sidenote
+
+import (
+	"bytes"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/jba/errside/parser"
+)
+
+// Code that looks like a side note, or holds a private-use character, must
+// not split a line.
+func TestFprintHTML(t *testing.T) {
+	const src = "package p\n\n" +
+		"func f() error {\n" +
+		"\ts := g(\"\uE000 =: err\") =: err; if err != nil { return err }\n" +
+		"\tn := h() =: err; if err != nil {\n" +
+		"\t\tlog.Print(err)\n" +
+		"\t\treturn err\n" +
+		"\t}\n" +
+		"\treturn nil\n" +
+		"}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SideNotes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (&Config{}).FprintHTML(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if n := strings.Count(got, "<details"); n != 2 {
+		t.Errorf("got %d side notes, want 2:\n%s", n, got)
+	}
+	if !strings.Contains(got, "<span class=\"literal\">&#34;\uE000 =: err&#34;</span><span class=\"operator\">)</span></div>") {
+		t.Errorf("string literal was split:\n%s", got)
+	}
+	if !strings.Contains(got, "<div>    <span class=\"ident\">log</span>") {
+		t.Errorf("handler of the second side note is not part of it:\n%s", got)
+	}
+	if strings.Contains(got, "<style>") {
+		t.Errorf("fragment holds the style of the document:\n%s", got)
+	}
+}
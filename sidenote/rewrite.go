@@ -0,0 +1,558 @@
+package sidenote
+
+import (
+	"go/constant"
+	"go/token"
+	"slices"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/errstmt"
+	"github.com/jba/errside/types"
+)
+
+// A rewriter holds the state of a call to Config.Rewrite.
+type rewriter struct {
+	patterns Pattern
+	anyError bool // see Config.AnyError
+	info     *types.Info
+	sites    []Site
+}
+
+func (r *rewriter) blockStmt(bs *ast.BlockStmt) {
+	var newList []ast.Stmt
+	for i := 0; i < len(bs.List); i++ {
+		stmt := bs.List[i]
+		newList = append(newList, stmt)
+		var (
+			init     ast.Stmt // init statement of the if or switch
+			errExpr  ast.Expr // variable tested
+			commaOk  bool
+			inverted bool     // if statement tests that errExpr is nil
+			after    ast.Stmt // error branch following an inverted if statement
+		)
+		switch s := stmt.(type) {
+		case *ast.IfStmt:
+			// We have an if statement.
+			// Does the if's test imply that an error variable is not nil,
+			// or check that a comma-ok expression failed?
+			// Or, inverted, does it test that an error variable is nil?
+			if errExpr = r.impliesError(s.Cond); errExpr == nil {
+				if errExpr = r.notOk(s.Cond); errExpr != nil && r.patterns&CommaOk != 0 {
+					commaOk = true
+				} else if errExpr, after = r.invertible(s, bs.List[i+1:]); errExpr != nil && r.patterns&Inverted != 0 {
+					inverted = true
+				} else {
+					continue
+				}
+			}
+			init = s.Init
+		case *ast.SwitchStmt:
+			// We have a switch statement.
+			// Does it dispatch on an error variable?
+			if r.patterns&ErrSwitch == 0 {
+				continue
+			}
+			if errExpr = r.switchVar(s); errExpr == nil {
+				continue
+			}
+			init = s.Init
+		default:
+			continue
+		}
+		// Yes it does.
+		// Was the previous statement (or the init statement) an assignment?
+		prevStmt := init
+		if prevStmt != nil {
+			if r.patterns&IfInit == 0 {
+				continue
+			}
+		} else if i > 0 && r.patterns&AssignThenIf != 0 {
+			prevStmt = bs.List[i-1]
+		}
+		if prevStmt == nil {
+			continue
+		}
+		aStmt, ok := prevStmt.(*ast.AssignStmt)
+		if !ok {
+			continue
+		}
+		// With the error variable removed from it, an assignment to it
+		// alone becomes its right-hand side, which must be able to stand
+		// alone as a statement: "v = err; if ..." is not a side note.
+		if len(aStmt.Lhs) == 1 && !errstmt.IsStmtExpr(aStmt.Rhs[0]) {
+			continue
+		}
+		// Yes it was.
+		// Was the last expr on the lhs of the assignment the same variable
+		// tested in the if or switch statement?
+		if !sameVar(aStmt.Lhs[len(aStmt.Lhs)-1], errExpr, r.info) {
+			continue
+		}
+		if commaOk && !r.isCommaOk(aStmt) {
+			continue
+		}
+		// Yes it was. We have something like
+		//    ..., err := ..
+		//    if err != nil { ... }
+		// or
+		//    x.err = ...
+		//    if x.err != nil { ... }
+		// or
+		//    v, ok := m[k]
+		//    if !ok { ... }
+		// or
+		//    switch err := f(); err { ... }
+		// or
+		//    v, err := f()
+		//    if err == nil { ... } else { return err }
+		n := len(newList)
+		// Make a new pseudo-statement that includes both the assignment
+		// and the test.
+		site := Site{Pos: aStmt.Pos(), End: stmt.End()}
+		var isInit bool
+		switch s := stmt.(type) {
+		case *ast.IfStmt:
+			newStmt := errstmt.NewAssignIfErrStmt(aStmt, s)
+			newStmt.CommaOk = commaOk
+			newStmt.Inverted = inverted
+			if after != nil {
+				newStmt.After = after
+				site.End = after.End()
+				i++
+			}
+			site.Stmt, isInit = newStmt, newStmt.IsInit
+		case *ast.SwitchStmt:
+			newStmt := errstmt.NewAssignSwitchErrStmt(aStmt, s)
+			site.Stmt, isInit = newStmt, newStmt.IsInit
+		}
+		if isInit {
+			site.Pos = stmt.Pos()
+			newList[n-1] = site.Stmt
+		} else {
+			// The last two elements of newList are the assignment and the if or switch.
+			// Replace both with the new "statement".
+			newList[n-2] = site.Stmt
+			newList = newList[:n-1]
+		}
+		r.sites = append(r.sites, site)
+	}
+	bs.List = newList
+}
+
+// invertible reports whether ifStmt tests that an error variable is nil
+// and can be printed as a side note with its branches swapped, and if so
+// returns the expression denoting the variable. Rest holds the statements
+// following ifStmt in its block.
+//
+// The swapped form runs the error branch in a new if statement, followed
+// by the statements of the success branch in the enclosing block. That has
+// the same meaning if
+//   - ifStmt has no init statement, which the success branch could use;
+//   - the error branch ends in a terminating statement, so that the
+//     success branch need not be skipped;
+//   - no name declared in the success branch is already declared in the
+//     enclosing block or appears in the rest of it.
+//
+// The error branch is the else branch of ifStmt or, if it has none, the
+// next statement, which is returned as well. That statement must itself
+// terminate, as must the success branch, so that it is only ever run when
+// the test fails.
+func (r *rewriter) invertible(ifStmt *ast.IfStmt, rest []ast.Stmt) (errExpr ast.Expr, after ast.Stmt) {
+	errExpr, tb := r.onError(ifStmt.Cond)
+	if tb != no || errExpr == nil || ifStmt.Init != nil || r.info.Scopes == nil {
+		return nil, nil
+	}
+	switch e := ifStmt.Else.(type) {
+	case *ast.BlockStmt:
+		if !r.terminates(e) {
+			return nil, nil
+		}
+	case nil:
+		if len(rest) == 0 || !r.terminates(ifStmt.Body) || !r.terminates(rest[0]) {
+			return nil, nil
+		}
+		if _, ok := rest[0].(*ast.LabeledStmt); ok {
+			return nil, nil
+		}
+		after = rest[0]
+		rest = rest[1:]
+	default:
+		return nil, nil
+	}
+	scope := r.info.Scopes[ifStmt.Body]
+	if scope == nil {
+		return nil, nil
+	}
+	outer := scope.Parent().Parent() // the if statement has a scope of its own
+	for _, name := range scope.Names() {
+		if outer.Lookup(name) != nil || mentions(rest, name) {
+			return nil, nil
+		}
+	}
+	return errExpr, after
+}
+
+// terminates reports whether s ends in a return, a panic or a branch
+// statement other than fallthrough, so that control never flows past it.
+func (r *rewriter) terminates(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		return len(s.List) > 0 && r.terminates(s.List[len(s.List)-1])
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BranchStmt:
+		return s.Tok != token.FALLTHROUGH
+	case *ast.ExprStmt:
+		call, ok := ast.Unparen(s.X).(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		id, ok := ast.Unparen(call.Fun).(*ast.Ident)
+		if !ok {
+			return false
+		}
+		b, ok := r.info.Uses[id].(*types.Builtin)
+		return ok && b.Name() == "panic"
+	}
+	return false
+}
+
+// mentions reports whether an identifier with the given name occurs in list.
+func mentions(list []ast.Stmt, name string) bool {
+	found := false
+	for _, s := range list {
+		ast.Inspect(s, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == name {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// switchVar reports whether the expression switch sw dispatches on an
+// error variable, and if so returns the expression denoting the variable.
+// Either the tag of sw is the variable, or sw has no tag and every case
+// compares the variable, with == or !=, to nil or another value.
+// Examples:
+//
+//	switch err { case nil: ...; case io.EOF: ... }
+//	switch { case err == io.EOF: ...; case err != nil: ... }
+func (r *rewriter) switchVar(sw *ast.SwitchStmt) ast.Expr {
+	if sw.Tag != nil {
+		if tag := ast.Unparen(sw.Tag); isVar(tag) && r.isError(r.info.TypeOf(tag)) {
+			return tag
+		}
+		return nil
+	}
+	var errExpr ast.Expr
+	for _, s := range sw.Body.List {
+		for _, e := range s.(*ast.CaseClause).List {
+			x := r.comparedError(e)
+			if x == nil || errExpr != nil && !sameVar(x, errExpr, r.info) {
+				return nil
+			}
+			errExpr = x
+		}
+	}
+	return errExpr
+}
+
+// comparedError reports whether expr compares an error variable to
+// another value with == or !=, and if so returns the expression denoting
+// the variable.
+func (r *rewriter) comparedError(expr ast.Expr) ast.Expr {
+	e, ok := ast.Unparen(expr).(*ast.BinaryExpr)
+	if !ok || e.Op != token.EQL && e.Op != token.NEQ {
+		return nil
+	}
+	for _, x := range []ast.Expr{e.X, e.Y} {
+		x = ast.Unparen(x)
+		if isVar(x) && r.isError(r.info.TypeOf(x)) {
+			return x
+		}
+	}
+	return nil
+}
+
+// sameVar reports whether e1 and e2 denote the same variable: the same
+// object, the same field of the same variable, the element of the same
+// variable at the same constant or variable index, or the variable that
+// the same pointer points to. Fields are compared through info.Selections,
+// so a field reached through an embedded struct matches only itself.
+// Function calls never match, because they may yield different results.
+func sameVar(e1, e2 ast.Expr, info *types.Info) bool {
+	e1, e2 = ast.Unparen(e1), ast.Unparen(e2)
+	switch x1 := e1.(type) {
+	case *ast.Ident:
+		x2, ok := e2.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		obj := info.ObjectOf(x1)
+		return obj != nil && obj == info.ObjectOf(x2)
+	case *ast.SelectorExpr:
+		x2, ok := e2.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+		s1, s2 := info.Selections[x1], info.Selections[x2]
+		if s1 == nil || s2 == nil {
+			// qualified identifiers: pkg.Var
+			return s1 == s2 && sameVar(x1.Sel, x2.Sel, info)
+		}
+		return s1.Kind() == types.FieldVal && s2.Kind() == types.FieldVal &&
+			s1.Obj() == s2.Obj() && slices.Equal(s1.Index(), s2.Index()) &&
+			sameVar(x1.X, x2.X, info)
+	case *ast.IndexExpr:
+		x2, ok := e2.(*ast.IndexExpr)
+		return ok && sameVar(x1.X, x2.X, info) && sameIndex(x1.Index, x2.Index, info)
+	case *ast.StarExpr:
+		x2, ok := e2.(*ast.StarExpr)
+		return ok && sameVar(x1.X, x2.X, info)
+	}
+	return false
+}
+
+// sameIndex reports whether the index expressions e1 and e2 are equal
+// constants or denote the same variable.
+func sameIndex(e1, e2 ast.Expr, info *types.Info) bool {
+	v1, v2 := info.Types[e1].Value, info.Types[e2].Value
+	if v1 != nil || v2 != nil {
+		return v1 != nil && v2 != nil && constant.Compare(v1, token.EQL, v2)
+	}
+	return sameVar(e1, e2, info)
+}
+
+// onError reports whether expr is an inequality check between nil and
+// a variable of type error (see isError). It also returns the expression
+// denoting the variable: an identifier, or a selector, index expression
+// or pointer indirection.
+// Examples:
+//
+//	err != nil
+//	!(err == nil)
+//	nil != err
+//	((err != nil))
+func (r *rewriter) onError(expr ast.Expr) (ast.Expr, tribool) {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.EQL:
+			x, t := r.errEqualsNil(e.X, e.Y)
+			return x, not(t)
+		case token.NEQ:
+			return r.errEqualsNil(e.X, e.Y)
+		default:
+			return nil, unknown
+		}
+	case *ast.ParenExpr:
+		return r.onError(e.X)
+	case *ast.UnaryExpr:
+		if e.Op == token.NOT {
+			x, t := r.onError(e.X)
+			return x, not(t)
+		}
+		return nil, unknown
+
+	default:
+		return nil, unknown
+	}
+}
+
+// impliesError reports whether expr can only be true if an error variable
+// is not nil, and if so returns the expression denoting the variable.
+// Besides the checks recognized by onError, expr may be a conjunction one
+// of whose operands implies it, or a disjunction all of whose operands
+// imply it for the same variable.
+// Examples:
+//
+//	err != nil && err != io.EOF
+//	ok && err != nil
+//	(err != nil && n == 0) || err != nil
+func (r *rewriter) impliesError(expr ast.Expr) ast.Expr {
+	e, ok := ast.Unparen(expr).(*ast.BinaryExpr)
+	if !ok || e.Op != token.LAND && e.Op != token.LOR {
+		if x, t := r.onError(expr); t == yes {
+			return x
+		}
+		return nil
+	}
+	x := r.impliesError(e.X)
+	y := r.impliesError(e.Y)
+	if e.Op == token.LAND {
+		if x != nil {
+			return x
+		}
+		return y
+	}
+	if x != nil && y != nil && sameVar(x, y, r.info) {
+		return x
+	}
+	return nil
+}
+
+// errEqualsNil reports whether the two exprs are a variable of type error and
+// nil. It returns the expression denoting the variable.
+func (r *rewriter) errEqualsNil(e1, e2 ast.Expr) (ast.Expr, tribool) {
+	t1 := r.info.TypeOf(e1)
+	t2 := r.info.TypeOf(e2)
+	var errExpr ast.Expr
+	if r.isError(t1) && isNil(t2) {
+		errExpr = e1
+	} else if r.isError(t2) && isNil(t1) {
+		errExpr = e2
+	}
+	if errExpr == nil {
+		return nil, no
+	}
+	if isVar(errExpr) {
+		return errExpr, yes
+	}
+	return nil, no
+}
+
+// notOk reports whether expr has the form !ok, where ok is a boolean
+// variable, and if so returns the expression denoting the variable.
+func (r *rewriter) notOk(expr ast.Expr) ast.Expr {
+	e, ok := ast.Unparen(expr).(*ast.UnaryExpr)
+	if !ok || e.Op != token.NOT {
+		return nil
+	}
+	x := ast.Unparen(e.X)
+	if !isVar(x) {
+		return nil
+	}
+	t := r.info.TypeOf(x)
+	if t == nil {
+		return nil
+	}
+	if b, ok := t.Underlying().(*types.Basic); !ok || b.Info()&types.IsBoolean == 0 {
+		return nil
+	}
+	return x
+}
+
+// isCommaOk reports whether as assigns the two results of a comma-ok
+// expression: a map index, a type assertion or a channel receive.
+func (r *rewriter) isCommaOk(as *ast.AssignStmt) bool {
+	if len(as.Lhs) != 2 || len(as.Rhs) != 1 {
+		return false
+	}
+	switch e := ast.Unparen(as.Rhs[0]).(type) {
+	case *ast.TypeAssertExpr:
+		return true
+	case *ast.UnaryExpr:
+		return e.Op == token.ARROW
+	case *ast.IndexExpr:
+		t := r.info.TypeOf(e.X)
+		if t == nil {
+			return false
+		}
+		_, isMap := t.Underlying().(*types.Map)
+		return isMap
+	}
+	return false
+}
+
+// isVar reports whether e has the form of a variable that sameVar can
+// match: an identifier, or a selector, index expression or pointer
+// indirection built from them.
+func isVar(e ast.Expr) bool {
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		return isVar(e.X)
+	case *ast.IndexExpr:
+		return isVar(e.X)
+	case *ast.StarExpr:
+		return isVar(e.X)
+	}
+	return false
+}
+
+// hasUnknownNilCheck reports whether body compares a value whose type
+// is unknown because of a type error with nil. Such a value may well
+// be an error, so the function should not be partially rewritten.
+func hasUnknownNilCheck(body *ast.BlockStmt, info *types.Info) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if e, ok := n.(*ast.BinaryExpr); ok && (e.Op == token.EQL || e.Op == token.NEQ) {
+			if isNilExpr(e.Y, info) && isUnknown(info.TypeOf(e.X)) ||
+				isNilExpr(e.X, info) && isUnknown(info.TypeOf(e.Y)) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// isNilExpr reports whether e denotes nil. The type checker does not
+// record the type of nil when it is compared to an invalid operand, so
+// an unrecorded identifier named nil counts.
+func isNilExpr(e ast.Expr, info *types.Info) bool {
+	if t := info.TypeOf(e); t != nil {
+		return isNil(t)
+	}
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == "nil"
+}
+
+// isUnknown reports whether t is missing or invalid.
+func isUnknown(t types.Type) bool {
+	return t == nil || t == types.Typ[types.Invalid]
+}
+
+// isNil reports whether type t the "untyped nil" type
+func isNil(t types.Type) bool {
+	if b, ok := t.(*types.Basic); ok {
+		if b.Kind() == types.UntypedNil {
+			return true
+		}
+	}
+	return false
+}
+
+// isError reports whether a variable of type t holds an error: t must be
+// the built-in error type, or, if r.anyError is set, any type other than
+// untyped nil that implements error.
+func (r *rewriter) isError(t types.Type) bool {
+	if r.anyError {
+		return !isUnknown(t) && !isNil(t) && types.Implements(t, errorInterface)
+	}
+	return isErrorType(t)
+}
+
+// errorInterface is the underlying interface of the built-in error type.
+var errorInterface = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// isErrorType reports whether t is the built-in error type.
+func isErrorType(t types.Type) bool {
+	nt, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	tn := nt.Obj()
+	return tn.Pkg() == nil && tn.Name() == "error"
+}
+
+type tribool int
+
+const (
+	unknown tribool = iota
+	no
+	yes
+)
+
+func not(t tribool) tribool {
+	switch t {
+	case no:
+		return yes
+	case yes:
+		return no
+	}
+	return unknown
+}
@@ -0,0 +1,801 @@
+package sidenote
+
+import (
+	"bytes"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/importer"
+	"github.com/jba/errside/parser"
+	"github.com/jba/errside/types"
+)
+
+// prelude starts the files of the rewrite tests.
+const prelude = `package p
+
+import (
+	"errors"
+	"io"
+)
+
+type S struct{ err error }
+
+func f() (int, error) { return 0, nil }
+
+func g() error { return nil }
+
+func h() (int, bool) { return 0, true }
+
+var _, _ = errors.New, io.EOF
+`
+
+// srcImporter imports packages from source for all tests, which import
+// the same few packages.
+var srcImporter = importer.For("source", nil)
+
+// checkSource parses and type-checks src, importing packages with
+// srcImporter.
+func checkSource(src string) (*token.FileSet, *ast.File, *types.Info, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info := &types.Info{
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Scopes:     make(map[ast.Node]*types.Scope),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{Importer: srcImporter}
+	if _, err := conf.Check(file.Name.Name, fset, []*ast.File{file}, info); err != nil {
+		return nil, nil, nil, err
+	}
+	return fset, file, info, nil
+}
+
+// rewriteSource is like Config.Source, with the packages that src imports
+// imported by srcImporter.
+func rewriteSource(cfg *Config, src string) ([]byte, error) {
+	fset, file, info, err := checkSource(src)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Rewrite(file, info)
+	var buf bytes.Buffer
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// collapse replaces each run of white space in s with a single space, so
+// that printed code can be compared without regard to its layout.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// testRewrite rewrites each function of tests with cfg and checks that it
+// is printed as want, ignoring layout.
+func testRewrite(t *testing.T, cfg *Config, tests []struct{ fn, want string }) {
+	t.Helper()
+	for _, test := range tests {
+		got, err := rewriteSource(cfg, prelude+"\n"+test.fn)
+		if err != nil {
+			t.Errorf("%s\n%v", test.fn, err)
+			continue
+		}
+		if !strings.HasSuffix(collapse(string(got)), collapse(test.want)) {
+			t.Errorf("%s\ngot:\n%s\nwant:\n%s", test.fn, got, test.want)
+		}
+	}
+}
+
+// Conditions that do not test the variable that was assigned are left
+// alone, even when the assignment's last operand is not an identifier.
+func TestRewriteOtherCondition(t *testing.T) {
+	testRewrite(t, &Config{}, []struct{ fn, want string }{
+		{
+			`func _(s *S) (n int) {
+	n, s.err = f()
+	if g() != nil {
+		return 0
+	}
+	return n
+}`,
+			`func _(s *S) (n int) {
+	n, s.err = f()
+	if g() != nil {
+		return 0
+	}
+	return n
+}`,
+		},
+		{
+			`func _(m map[string]error) (n int) {
+	n, m["k"] = f()
+	if m["j"] != nil {
+		return 0
+	}
+	return n
+}`,
+			`func _(m map[string]error) (n int) {
+	n, m["k"] = f()
+	if m["j"] != nil {
+		return 0
+	}
+	return n
+}`,
+		},
+		{
+			`func _(s *S) (n int) {
+	n, s.err = f()
+	if s.err != nil {
+		return 0
+	}
+	return n
+}`,
+			`func _(s *S) (n int) {
+	n = f() = s.err; if s.err != nil { return 0 }
+	return n
+}`,
+		},
+	})
+}
+
+// Conditions that can only hold when the error is not nil are folded, in
+// whatever form they are written, with the condition kept as written.
+func TestRewriteConditions(t *testing.T) {
+	testRewrite(t, &Config{}, []struct{ fn, want string }{
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n := f() =: err; if err != nil && err != io.EOF {
+		return 0, err
+	}
+	return n, nil
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if nil != err {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n := f() =: err; if nil != err { return 0, err }
+	return n, nil
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if (nil) != (err) {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n := f() =: err; if (nil) != (err) { return 0, err }
+	return n, nil
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if !(err == nil) {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n := f() =: err; if !(err == nil) { return 0, err }
+	return n, nil
+}`,
+		},
+		{
+			`func _(ok bool) (int, error) {
+	n, err := f()
+	if ok && err != nil {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _(ok bool) (int, error) {
+	n := f() =: err; if ok && err != nil { return 0, err }
+	return n, nil
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if (err != nil && n == 0) || err != nil {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n := f() =: err; if (err != nil && n == 0) || err != nil {
+		return 0, err
+	}
+	return n, nil
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n, err := f()
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return n, nil
+}`,
+		},
+		{
+			`func _(e error) (int, error) {
+	n, err := f()
+	if err != nil || e != nil {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _(e error) (int, error) {
+	n, err := f()
+	if err != nil || e != nil {
+		return 0, err
+	}
+	return n, nil
+}`,
+		},
+	})
+}
+
+// Failed comma-ok expressions are folded; other boolean results are not.
+func TestRewriteCommaOk(t *testing.T) {
+	testRewrite(t, &Config{}, []struct{ fn, want string }{
+		{
+			`func _(m map[string]int) int {
+	v, ok := m["a"]
+	if !ok {
+		return -1
+	}
+	return v
+}`,
+			`func _(m map[string]int) int {
+	v := m["a"] =: ok; if !ok { return -1 }
+	return v
+}`,
+		},
+		{
+			`func _(x any) string {
+	s, ok := x.(string)
+	if !(ok) {
+		return ""
+	}
+	return s
+}`,
+			`func _(x any) string {
+	s := x.(string) =: ok; if !(ok) { return "" }
+	return s
+}`,
+		},
+		{
+			`func _(c chan int) int {
+	v, ok := <-c
+	if !ok {
+		return -1
+	}
+	return v
+}`,
+			`func _(c chan int) int {
+	v := <-c =: ok; if !ok { return -1 }
+	return v
+}`,
+		},
+		{
+			`func _(m map[string]int) int {
+	if v, ok := m["a"]; !ok {
+		return v
+	}
+	return -1
+}`,
+			`func _(m map[string]int) int {
+	v := m["a"] =: ok if !ok { return v }
+	return -1
+}`,
+		},
+		{
+			`func _() int {
+	v, ok := h()
+	if !ok {
+		return -1
+	}
+	return v
+}`,
+			`func _() int {
+	v, ok := h()
+	if !ok {
+		return -1
+	}
+	return v
+}`,
+		},
+		{
+			`func _(m map[string]int) int {
+	v, ok := m["a"]
+	if ok {
+		return v
+	}
+	return -1
+}`,
+			`func _(m map[string]int) int {
+	v, ok := m["a"]
+	if ok {
+		return v
+	}
+	return -1
+}`,
+		},
+	})
+}
+
+// A check with the success branch inside is turned inside out, but only
+// when the error branch terminates and the success branch declares nothing
+// that is used after it. An error branch in the else branch may follow a
+// success branch that does not terminate. An error branch that is the next
+// statement must be skipped by the success branch, which must terminate.
+func TestRewriteInverted(t *testing.T) {
+	testRewrite(t, &Config{}, []struct{ fn, want string }{
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		n++
+	} else {
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n := f() =: err; if err != nil { return 0, err }
+	n++
+	return n, nil
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		n++
+	} else {
+		n--
+	}
+	return n, err
+}`,
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		n++
+	} else {
+		n--
+	}
+	return n, err
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		return n, nil
+	} else {
+		return 0, err
+	}
+}`,
+			`func _() (int, error) {
+	n := f() =: err; if err != nil { return 0, err }
+	return n, nil
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		m := n + 1
+		return m, nil
+	}
+	return 0, err
+}`,
+			`func _() (int, error) {
+	n := f() =: err; if err != nil { return 0, err }
+	m := n + 1
+	return m, nil
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		n++
+	}
+	return n, err
+}`,
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		n++
+	}
+	return n, err
+}`,
+		},
+		{
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		return n, nil
+	}
+	m := 0
+	return m, err
+}`,
+			`func _() (int, error) {
+	n, err := f()
+	if err == nil {
+		return n, nil
+	}
+	m := 0
+	return m, err
+}`,
+		},
+	})
+}
+
+// A function that compares a value whose type is unknown, because of a type
+// error, with nil is left alone; the other functions are rewritten.
+func TestRewriteUnknownType(t *testing.T) {
+	src := prelude + `
+func unknown() (int, error) {
+	n, err := f()
+	if err != nil {
+		return 0, err
+	}
+	m, err2 := undefined()
+	if err2 != nil {
+		return 0, err2
+	}
+	return n + m, nil
+}
+
+func known() (int, error) {
+	n, err := f()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+		Types: make(map[ast.Expr]types.TypeAndValue),
+	}
+	var typeErrs []error
+	conf := types.Config{
+		Importer: srcImporter,
+		Error:    func(err error) { typeErrs = append(typeErrs, err) },
+	}
+	conf.Check("p", fset, []*ast.File{file}, info)
+	if len(typeErrs) == 0 {
+		t.Fatal("no type errors")
+	}
+	cfg := &Config{}
+	cfg.Rewrite(file, info)
+	var buf bytes.Buffer
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	got := collapse(buf.String())
+	for _, want := range []string{
+		"func unknown() (int, error) { n, err := f() if err != nil { return 0, err }",
+		"func known() (int, error) { n := f() =: err; if err != nil { return 0, err } return n, nil }",
+	} {
+		if !strings.Contains(got, collapse(want)) {
+			t.Errorf("output does not contain\n%s\ngot:\n%s", want, buf.Bytes())
+		}
+	}
+}
+
+// With AnyError, checks on variables of any type that implements error are
+// folded; by default, only those on variables of type error are.
+func TestRewriteAnyError(t *testing.T) {
+	const src = `package p
+
+import "net"
+
+type MyErr struct{}
+
+func (*MyErr) Error() string { return "" }
+
+func my() (int, *MyErr) { return 0, nil }
+
+func dial() (int, net.Error) { return 0, nil }
+
+func useMy() (int, error) {
+	n, err := my()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func useNet() (int, error) {
+	n, err := dial()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+`
+	for _, test := range []struct {
+		anyError bool
+		want     []string
+	}{
+		{
+			false,
+			[]string{
+				"func useMy() (int, error) { n, err := my() if err != nil { return 0, err }",
+				"func useNet() (int, error) { n, err := dial() if err != nil { return 0, err }",
+			},
+		},
+		{
+			true,
+			[]string{
+				"func useMy() (int, error) { n := my() =: err; if err != nil { return 0, err }",
+				"func useNet() (int, error) { n := dial() =: err; if err != nil { return 0, err }",
+			},
+		},
+	} {
+		got, err := rewriteSource(&Config{AnyError: test.anyError}, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(collapse(string(got)), collapse(want)) {
+				t.Errorf("AnyError=%t: output does not contain\n%s\ngot:\n%s", test.anyError, want, got)
+			}
+		}
+	}
+}
+
+// Expression switches on an error variable are folded, with the variable as
+// their tag or compared in every case.
+func TestRewriteSwitch(t *testing.T) {
+	testRewrite(t, &Config{}, []struct{ fn, want string }{
+		// The tag form.
+		{
+			`func _() (int, error) {
+	n, err := f()
+	switch err {
+	case nil:
+	case io.EOF:
+		return n, nil
+	default:
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n := f() =: err; switch err {
+	case nil:
+	case io.EOF:
+		return n, nil
+	default:
+		return 0, err
+	}
+	return n, nil
+}`,
+		},
+		// The init form.
+		{
+			`func _() error {
+	switch err := g(); err {
+	case nil:
+		return nil
+	default:
+		return err
+	}
+}`,
+			`func _() error {
+	g() =: err switch err {
+	case nil:
+		return nil
+	default:
+		return err
+	}
+}`,
+		},
+		// The tagless form.
+		{
+			`func _() (int, error) {
+	n, err := f()
+	switch {
+	case err == io.EOF:
+		return n, nil
+	case err != nil:
+		return 0, err
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	n := f() =: err; switch {
+	case err == io.EOF:
+		return n, nil
+	case err != nil:
+		return 0, err
+	}
+	return n, nil
+}`,
+		},
+		// Cases that compare different variables.
+		{
+			`func _() (int, error) {
+	err2 := g()
+	n, err := f()
+	switch {
+	case err == io.EOF:
+		return n, nil
+	case err2 != nil:
+		return 0, err2
+	}
+	return n, nil
+}`,
+			`func _() (int, error) {
+	err2 := g()
+	n, err := f()
+	switch {
+	case err == io.EOF:
+		return n, nil
+	case err2 != nil:
+		return 0, err2
+	}
+	return n, nil
+}`,
+		},
+		// A switch with only a default case.
+		{
+			`func _() (int, error) {
+	n, err := f()
+	switch {
+	default:
+		return n, err
+	}
+}`,
+			`func _() (int, error) {
+	n, err := f()
+	switch {
+	default:
+		return n, err
+	}
+}`,
+		},
+	})
+}
+
+// Side notes work in generic functions and methods, with errors whose
+// values depend on type parameters.
+func TestRewriteGeneric(t *testing.T) {
+	testRewrite(t, &Config{}, []struct{ fn, want string }{
+		{
+			`func first[T any](xs []T, get func(T) (T, error)) (T, error) {
+	var zero T
+	x, err := get(xs[0])
+	if err != nil {
+		return zero, err
+	}
+	return x, nil
+}`,
+			`func first[T any](xs []T, get func(T) (T, error)) (T, error) {
+	var zero T
+	x := get(xs[0]) =: err; if err != nil { return zero, err }
+	return x, nil
+}`,
+		},
+		{
+			`type list[E comparable] struct{ elems []E }
+
+func (l *list[E]) load(read func() (E, error)) error {
+	e, err := read()
+	if err != nil {
+		return err
+	}
+	l.elems = append(l.elems, e)
+	return nil
+}`,
+			`func (l *list[E]) load(read func() (E, error)) error {
+	e := read() =: err; if err != nil { return err }
+	l.elems = append(l.elems, e)
+	return nil
+}`,
+		},
+	})
+}
+
+// Error variables may be pointer indirections, index expressions and
+// fields, also promoted from embedded structs.
+func TestRewriteErrVars(t *testing.T) {
+	testRewrite(t, &Config{}, []struct{ fn, want string }{
+		{
+			`type T struct{ S }
+
+func _(perr *error, errs []error, i int, t *T) (int, error) {
+	var n, m, k int
+	n, *perr = f()
+	if *perr != nil {
+		return 0, *perr
+	}
+	m, errs[i] = f()
+	if errs[i] != nil {
+		return 0, errs[i]
+	}
+	k, t.err = f()
+	if t.err != nil {
+		return 0, t.err
+	}
+	return n + m + k, nil
+}`,
+			`func _(perr *error, errs []error, i int, t *T) (int, error) {
+	var n, m, k int
+	n = f() = *perr; if *perr != nil { return 0, *perr }
+	m = f() = errs[i]; if errs[i] != nil { return 0, errs[i] }
+	k = f() = t.err; if t.err != nil { return 0, t.err }
+	return n + m + k, nil
+}`,
+		},
+		{
+			`func _(perr, perr2 *error, errs []error, i int) (int, error) {
+	var n int
+	n, *perr = f()
+	if *perr2 != nil {
+		return 0, *perr2
+	}
+	n, errs[i] = f()
+	if errs[0] != nil {
+		return 0, errs[0]
+	}
+	return n, nil
+}`,
+			`func _(perr, perr2 *error, errs []error, i int) (int, error) {
+	var n int
+	n, *perr = f()
+	if *perr2 != nil {
+		return 0, *perr2
+	}
+	n, errs[i] = f()
+	if errs[0] != nil {
+		return 0, errs[0]
+	}
+	return n, nil
+}`,
+		},
+	})
+}
@@ -0,0 +1,173 @@
+// Package sidenote rewrites Go error checks as side notes.
+//
+// A side note combines an assignment to an error variable with the if
+// statement that tests it, so that the error handling can be printed on
+// the right side of the screen:
+//
+//	dirs := getContentFolders(to)                   =: err; if err != nil { return nil, err }
+//
+// Rewrite performs the transformation on a type-checked file, and Source
+// goes directly from Go source to side-note text.
+package sidenote
+
+import (
+	"bytes"
+	"go/token"
+	"io"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/importer"
+	"github.com/jba/errside/parser"
+	"github.com/jba/errside/printer"
+	"github.com/jba/errside/types"
+)
+
+// A Pattern is a set of flags selecting the error checks to fold.
+type Pattern uint
+
+const (
+	AssignThenIf Pattern = 1 << iota // "x, err := f()" followed by "if err != nil { ... }"
+	IfInit                           // "if x, err := f(); err != nil { ... }"
+	CommaOk                          // "v, ok := m[k]", "x.(T)" or "<-c" tested with "if !ok { ... }"
+	ErrSwitch                        // "switch err { ... }" or "switch { case err == io.EOF: ... }", with AssignThenIf or IfInit
+	Inverted                         // "if err == nil { ... } else { return err }", with AssignThenIf
+
+	DefaultPatterns = AssignThenIf | IfInit | CommaOk | ErrSwitch | Inverted
+)
+
+// A Config controls the side-note transformation.
+type Config struct {
+	Patterns Pattern // default: DefaultPatterns
+	Errcol   int     // column of side notes; default: 50
+	Tabwidth int     // default: 4
+	Width    int     // maximum width of a line holding a one-line side note; default: 100, negative for no limit
+
+	// AnyError makes Rewrite fold checks on variables of any type that
+	// implements error, such as *url.Error or net.Error, rather than
+	// only on those of the built-in error type.
+	AnyError bool
+
+	// Glyphs makes Fprint print common error branches in a compact form,
+	// such as "⇑ err" for one that returns the error. The output is for
+	// reading only; it cannot be parsed back.
+	Glyphs bool
+
+	// Terminal makes Fprint print for a terminal: side notes are shown in
+	// NoteColor, and one that would start within 20 columns of Width is
+	// moved to the next line, behind a marker. The output cannot be parsed
+	// back. NoteColor holds SGR parameters; the default is "2", dim.
+	Terminal  bool
+	NoteColor string
+
+	// AutoErrcol makes Fprint choose the error column of each function
+	// instead of using Errcol: the column just past its widest statement
+	// with a side note, between MinErrcol and MaxErrcol. The side notes
+	// of wider statements start on the following line. A MaxErrcol of 0
+	// means 20 columns before Width.
+	AutoErrcol           bool
+	MinErrcol, MaxErrcol int
+}
+
+// A Site describes an error check that was folded into a side note.
+type Site struct {
+	Pos, End token.Pos // source extent of the original assignment and if or switch statement
+	Stmt     ast.Stmt  // the side note that replaced them: an *errstmt.AssignIfErrStmt or *errstmt.AssignSwitchErrStmt
+}
+
+func (cfg *Config) patterns() Pattern {
+	if cfg.Patterns == 0 {
+		return DefaultPatterns
+	}
+	return cfg.Patterns
+}
+
+// Rewrite replaces the error checks in file with side notes and returns the
+// file along with the folded sites, in source order. The file is modified in
+// place. Info must hold the Defs, Uses, Types, Scopes and Selections recorded
+// when type-checking the file.
+//
+// The file need not have type-checked without errors. Functions that
+// compare a value of unknown type to nil are left unchanged.
+func (cfg *Config) Rewrite(file *ast.File, info *types.Info) (*ast.File, []Site) {
+	r := rewriter{patterns: cfg.patterns(), anyError: cfg.AnyError, info: info}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			return n.Body == nil || !hasUnknownNilCheck(n.Body, info)
+		case *ast.FuncLit:
+			return !hasUnknownNilCheck(n.Body, info)
+		case *ast.BlockStmt:
+			r.blockStmt(n)
+		}
+		return true
+	})
+	return file, r.sites
+}
+
+// Fprint prints file, which may contain side notes, to w.
+func (cfg *Config) Fprint(w io.Writer, fset *token.FileSet, file *ast.File) error {
+	return cfg.printerConfig().Fprint(w, fset, file)
+}
+
+// printerConfig returns the printer configuration for cfg.
+func (cfg *Config) printerConfig() *printer.Config {
+	pcfg := &printer.Config{
+		Mode:     printer.UseSpaces,
+		Tabwidth: cfg.Tabwidth,
+		Errcol:   cfg.Errcol,
+		Width:    cfg.Width,
+	}
+	if cfg.Glyphs {
+		pcfg.Mode |= printer.HandlerGlyphs
+	}
+	if cfg.Terminal {
+		pcfg.Mode |= printer.Terminal
+		pcfg.NoteColor = cfg.NoteColor
+	}
+	if cfg.AutoErrcol {
+		pcfg.Mode |= printer.AutoErrcol
+		pcfg.MinErrcol = cfg.MinErrcol
+		pcfg.MaxErrcol = cfg.MaxErrcol
+	}
+	if pcfg.Tabwidth == 0 {
+		pcfg.Tabwidth = 4
+	}
+	if pcfg.Errcol == 0 {
+		pcfg.Errcol = 50
+	}
+	switch {
+	case pcfg.Width == 0:
+		pcfg.Width = 100
+	case pcfg.Width < 0:
+		pcfg.Width = 0
+	}
+	return pcfg
+}
+
+// Source parses and type-checks src as a single-file package, rewrites it
+// and returns the side-note text. Filename is used for positions in error
+// messages. Imported packages are type-checked from source.
+func (cfg *Config) Source(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	info := &types.Info{
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Scopes:     make(map[ast.Node]*types.Scope),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{Importer: importer.For("source", nil)}
+	if _, err := conf.Check(file.Name.Name, fset, []*ast.File{file}, info); err != nil {
+		return nil, err
+	}
+	cfg.Rewrite(file, info)
+	var buf bytes.Buffer
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,298 @@
+package sidenote
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"math"
+	"reflect"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/errstmt"
+	"github.com/jba/errside/parser"
+	"github.com/jba/errside/printer"
+	"github.com/jba/errside/types"
+)
+
+// A Problem describes a side note that does not read back as the code it
+// replaced, or that hides something about that code a reader should know.
+type Problem struct {
+	Pos token.Position
+	Msg string
+}
+
+func (p Problem) String() string { return fmt.Sprintf("%s: %s", p.Pos, p.Msg) }
+
+// Verify checks the side notes that Rewrite introduced into file, whose
+// source before rewriting was src. Info and sites are those passed to and
+// returned by Rewrite.
+//
+// Verify prints file as side-note text, parses it back, expands the side
+// notes into standard Go and compares the result structurally with src.
+// An inverted side note reads back with its error branch first and its
+// success branch after it, so that is the form it is compared with. If
+// check is not nil, it is called to type-check the expansion, which has
+// been parsed into the given file set.
+//
+// Verify also reports side notes that hide a meaningful difference: an
+// error variable declared with =: that shadows another, one that is read
+// after the side note, and one that is a named result parameter.
+func (cfg *Config) Verify(fset *token.FileSet, file *ast.File, src []byte, info *types.Info, sites []Site, check func(*token.FileSet, *ast.File) error) []Problem {
+	v := verifier{fset: fset, inverted: map[int]bool{}}
+	filename := fset.Position(file.Package).Filename
+	for _, s := range sites {
+		if st, ok := s.Stmt.(*errstmt.AssignIfErrStmt); ok && st.Inverted {
+			v.inverted[fset.Position(st.IfStmt.If).Offset] = true
+		}
+	}
+
+	// Read the side-note text back and expand it.
+	var buf bytes.Buffer
+	rcfg := *cfg
+	rcfg.Glyphs, rcfg.Terminal = false, false
+	if err := rcfg.Fprint(&buf, fset, file); err != nil {
+		v.report(file.Package, "cannot print side notes: %v", err)
+		return v.problems
+	}
+	rfset := token.NewFileSet()
+	rfile, err := parser.ParseFile(rfset, filename, buf.Bytes(), parser.SideNotes|parser.ParseComments)
+	if err != nil {
+		v.report(file.Package, "side-note text does not parse: %v", err)
+		return v.problems
+	}
+	buf.Reset()
+	pcfg := &printer.Config{Mode: printer.ExpandSideNotes | printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := pcfg.Fprint(&buf, rfset, rfile); err != nil {
+		v.report(file.Package, "cannot expand side notes: %v", err)
+		return v.problems
+	}
+	xfset := token.NewFileSet()
+	xfile, err := parser.ParseFile(xfset, filename, buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		v.report(file.Package, "expanded side notes do not parse: %v", err)
+		return v.problems
+	}
+	v.ofset = token.NewFileSet()
+	ofile, err := parser.ParseFile(v.ofset, filename, src, parser.ParseComments)
+	if err != nil {
+		v.report(file.Package, "cannot parse original source: %v", err)
+		return v.problems
+	}
+	if n := v.diff(reflect.ValueOf(xfile), reflect.ValueOf(ofile), ofile); n != nil {
+		v.problems = append(v.problems, Problem{Pos: v.ofset.Position(n.Pos()), Msg: "side notes read back as different code"})
+	}
+	if check != nil {
+		if err := check(xfset, xfile); err != nil {
+			v.report(file.Package, "expanded side notes do not type-check: %v", err)
+		}
+	}
+
+	// Look for differences that the side notes hide.
+	results := map[types.Object]bool{}
+	writes := map[*ast.Ident]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncType:
+			if n.Results != nil {
+				for _, f := range n.Results.List {
+					for _, id := range f.Names {
+						results[info.Defs[id]] = true
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			for _, e := range n.Lhs {
+				if id, ok := e.(*ast.Ident); ok {
+					writes[id] = true
+				}
+			}
+		}
+		return true
+	})
+	inSite := func(pos token.Pos) bool {
+		for _, s := range sites {
+			if s.Pos <= pos && pos < s.End {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range sites {
+		var isShort bool
+		switch st := s.Stmt.(type) {
+		case *errstmt.AssignIfErrStmt:
+			isShort = st.IsShort
+		case *errstmt.AssignSwitchErrStmt:
+			isShort = st.IsShort
+		}
+		id, ok := ast.Unparen(siteVar(s)).(*ast.Ident)
+		if !ok || id.Name == "_" {
+			continue
+		}
+		obj, _ := info.ObjectOf(id).(*types.Var)
+		if obj == nil {
+			continue
+		}
+		if isShort && info.Defs[id] != nil && obj.Parent() != nil {
+			if scope, outer := obj.Parent().Parent().LookupParent(id.Name, obj.Pos()); outer != nil && scope != types.Universe {
+				v.report(id.Pos(), "%s declared with =: shadows %s", id.Name, id.Name)
+			}
+		}
+		if results[obj] {
+			v.report(id.Pos(), "%s is a named result; the side note hides an assignment to it", id.Name)
+		}
+		// A use after the side note sees the value assigned in it,
+		// unless the variable is assigned again in between.
+		next := token.Pos(math.MaxInt) // the next assignment, if any
+		for w := range writes {
+			if info.ObjectOf(w) == obj && w.Pos() >= s.End && w.Pos() < next {
+				next = w.Pos()
+			}
+		}
+		for _, s2 := range sites {
+			if s2.Pos >= s.End && s2.Pos < next && sameVar(siteVar(s2), id, info) {
+				next = s2.Pos
+			}
+		}
+		var last token.Pos
+		for use, o := range info.Uses {
+			if o == obj && use.Pos() >= s.End && use.Pos() < next && !writes[use] && !inSite(use.Pos()) && (last == token.NoPos || use.Pos() < last) {
+				last = use.Pos()
+			}
+		}
+		if last.IsValid() {
+			v.report(id.Pos(), "%s is used after the side note, at line %d", id.Name, fset.Position(last).Line)
+		}
+	}
+	return v.problems
+}
+
+// siteVar returns the error variable of the side note at s.
+func siteVar(s Site) ast.Expr {
+	switch st := s.Stmt.(type) {
+	case *errstmt.AssignIfErrStmt:
+		return st.ErrVar
+	case *errstmt.AssignSwitchErrStmt:
+		return st.ErrVar
+	}
+	return nil
+}
+
+// A verifier holds the state of a call to Config.Verify.
+type verifier struct {
+	fset     *token.FileSet
+	ofset    *token.FileSet // file set of the original source
+	inverted map[int]bool   // offsets of the if statements of inverted side notes
+	problems []Problem
+}
+
+func (v *verifier) report(pos token.Pos, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Pos: v.fset.Position(pos), Msg: fmt.Sprintf(format, args...)})
+}
+
+var (
+	posType       = reflect.TypeOf(token.NoPos)
+	stmtListType  = reflect.TypeOf([]ast.Stmt(nil))
+	commentsType  = reflect.TypeOf((*ast.CommentGroup)(nil))
+	commentsTypes = reflect.TypeOf([]*ast.CommentGroup(nil))
+	objectType    = reflect.TypeOf((*ast.Object)(nil))
+	scopeType     = reflect.TypeOf((*ast.Scope)(nil))
+	nodeType      = reflect.TypeOf((*ast.Node)(nil)).Elem()
+)
+
+// diff compares got, read back from side-note text, with want, from the
+// original source, ignoring positions, comments and resolution. It returns
+// the innermost node of want that encloses the first difference, or nil.
+// Outer is the innermost node enclosing want.
+func (v *verifier) diff(got, want reflect.Value, outer ast.Node) ast.Node {
+	if want.Type() == stmtListType {
+		want = reflect.ValueOf(v.flatten(want.Interface().([]ast.Stmt)))
+	}
+	if want.Kind() != reflect.Interface && want.Type().Implements(nodeType) && want.CanInterface() {
+		if n, ok := want.Interface().(ast.Node); ok && !(want.Kind() == reflect.Pointer && want.IsNil()) {
+			outer = n
+		}
+	}
+	switch want.Kind() {
+	case reflect.Interface:
+		if got.IsNil() || want.IsNil() {
+			if got.IsNil() != want.IsNil() {
+				return outer
+			}
+			return nil
+		}
+		got, want = got.Elem(), want.Elem()
+		if got.Type() != want.Type() {
+			return outer
+		}
+		return v.diff(got, want, outer)
+	case reflect.Pointer:
+		if got.IsNil() || want.IsNil() {
+			if got.IsNil() != want.IsNil() {
+				return outer
+			}
+			return nil
+		}
+		return v.diff(got.Elem(), want.Elem(), outer)
+	case reflect.Struct:
+		for i := 0; i < want.NumField(); i++ {
+			switch want.Type().Field(i).Type {
+			case posType, commentsType, commentsTypes, objectType, scopeType:
+				continue
+			}
+			if want.Type().Field(i).Name == "Unresolved" {
+				continue
+			}
+			if n := v.diff(got.Field(i), want.Field(i), outer); n != nil {
+				return n
+			}
+		}
+		return nil
+	case reflect.Slice:
+		if got.Len() != want.Len() {
+			return outer
+		}
+		for i := 0; i < want.Len(); i++ {
+			if n := v.diff(got.Index(i), want.Index(i), outer); n != nil {
+				return n
+			}
+		}
+		return nil
+	default:
+		if got.Interface() != want.Interface() {
+			return outer
+		}
+		return nil
+	}
+}
+
+// flatten returns list, from the original source, with the if statements
+// of inverted side notes in the form they read back as: an if statement
+// that tests the error variable of the preceding assignment and runs the
+// error branch, followed by the statements of the success branch.
+func (v *verifier) flatten(list []ast.Stmt) []ast.Stmt {
+	var out []ast.Stmt
+	for i := 0; i < len(list); i++ {
+		s, ok := list[i].(*ast.IfStmt)
+		if !ok || i == 0 || !v.inverted[v.ofset.Position(s.If).Offset] {
+			out = append(out, list[i])
+			continue
+		}
+		as, ok := list[i-1].(*ast.AssignStmt)
+		if !ok {
+			out = append(out, list[i])
+			continue
+		}
+		body, _ := s.Else.(*ast.BlockStmt)
+		if body == nil && i+1 < len(list) {
+			i++
+			body = &ast.BlockStmt{List: []ast.Stmt{list[i]}}
+		}
+		out = append(out, &ast.IfStmt{
+			Cond: &ast.BinaryExpr{X: as.Lhs[len(as.Lhs)-1], Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+			Body: body,
+		})
+		out = append(out, v.flatten(s.Body.List)...)
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package sidenote
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jba/errside/ast"
+	"github.com/jba/errside/errstmt"
+)
+
+// verifySource rewrites the function fn, calls tamper, if not nil, on the
+// rewritten file and returns the problems that Verify reports. After the
+// prelude, fn starts on line 18.
+func verifySource(t *testing.T, fn string, tamper func(*ast.File)) []Problem {
+	t.Helper()
+	src := prelude + "\n" + fn
+	fset, file, info, err := checkSource(src)
+	if err != nil {
+		t.Fatalf("%s\n%v", fn, err)
+	}
+	cfg := &Config{}
+	_, sites := cfg.Rewrite(file, info)
+	if len(sites) == 0 {
+		t.Fatalf("%s\nno side notes", fn)
+	}
+	if tamper != nil {
+		tamper(file)
+	}
+	return cfg.Verify(fset, file, []byte(src), info, sites, nil)
+}
+
+func TestVerify(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		fn   string
+		want string // the message of the only problem, or "" for none
+	}{
+		{
+			"clean",
+			`func _() (int, error) {
+	n, err := f()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}`,
+			"",
+		},
+		{
+			"shadows",
+			`func _() (int, error) {
+	var err error
+	if true {
+		n, err := f()
+		if err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+	return 0, err
+}`,
+			"err declared with =: shadows err",
+		},
+		{
+			"named result",
+			`func _() (n int, err error) {
+	n, err = f()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}`,
+			"err is a named result; the side note hides an assignment to it",
+		},
+		{
+			"used after",
+			`func _() (int, error) {
+	n, err := f()
+	if err != nil {
+		return 0, err
+	}
+	return n, err
+}`,
+			"err is used after the side note, at line 23",
+		},
+		{
+			"assigned again",
+			`func _() (int, error) {
+	n, err := f()
+	if err != nil {
+		return 0, err
+	}
+	err = g()
+	return n, err
+}`,
+			"",
+		},
+	} {
+		var msgs []string
+		for _, p := range verifySource(t, test.fn, nil) {
+			msgs = append(msgs, p.Msg)
+		}
+		var want []string
+		if test.want != "" {
+			want = []string{test.want}
+		}
+		if strings.Join(msgs, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: got %q, want %q", test.name, msgs, want)
+		}
+	}
+}
+
+// A side note that does not read back as the code it replaced is reported
+// at the position of the difference in the original source.
+func TestVerifyReadsBackDifferently(t *testing.T) {
+	fn := `func _() (int, error) {
+	n, err := f()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}`
+	probs := verifySource(t, fn, func(file *ast.File) {
+		// Change the 0 in the error branch to 1.
+		ast.Inspect(file, func(n ast.Node) bool {
+			if s, ok := n.(*errstmt.AssignIfErrStmt); ok {
+				ret := s.IfStmt.Body.List[0].(*ast.ReturnStmt)
+				ret.Results[0].(*ast.BasicLit).Value = "1"
+				return false
+			}
+			return true
+		})
+	})
+	if len(probs) != 1 {
+		t.Fatalf("got %v, want one problem", probs)
+	}
+	if got, want := probs[0].Msg, "side notes read back as different code"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := probs[0].Pos.Line, 21; got != want {
+		t.Errorf("reported at line %d, want %d", got, want)
+	}
+}
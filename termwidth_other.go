@@ -0,0 +1,8 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// fileWidth returns 0: terminal widths are not known on this system.
+func fileWidth(f *os.File) int { return 0 }